@@ -0,0 +1,126 @@
+package crt571
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type CRT571AcceptSteps struct {
+	Position     CRT571Position                                                           // CRT571_POSITION_IC (default) or _RF
+	Validate     func(ctx context.Context, service *CRT571Service) (keep bool, err error) // Called with card on Position, keep it for reissue or capture
+	PollInterval time.Duration                                                            // CRT571_DEFAULT_POLL_INTERVAL if 0
+}
+
+type CRT571AcceptOutcome struct {
+	Kept       bool // Card is on card holding position for reissue
+	Captured   bool // Card was captured to error card bin
+	Capture    *CRT571CaptureResult
+	Status     CRT571DeviceStatus // Last device status
+	CaptureErr error              // Capture failure, card may be left in device (see Status)
+}
+
+func (outcome *CRT571AcceptOutcome) String() string {
+	switch {
+	case outcome.Kept:
+		return "returned card kept on card holding position"
+	case outcome.Captured:
+		return fmt.Sprintf("returned card captured, error bin counter %d", outcome.Capture.BinCountAfter)
+	}
+	return "no returned card"
+}
+
+// Accept card returned by customer: enable card entry from gate, wait until
+// card is inserted (use ctx deadline to limit waiting), move it to IC/RF position,
+// validate it, then keep it on card holding position or capture it to error
+// card bin. Card entry is disabled on return. Any failure after card was
+// inserted (move, validation, ctx cancellation) captures card.
+func (service *CRT571Service) AcceptReturnedCard(ctx context.Context, steps CRT571AcceptSteps) (outcome *CRT571AcceptOutcome, err error) {
+	outcome = &CRT571AcceptOutcome{}
+
+	if steps.Position == CRT571_POSITION_UNKNOWN {
+		steps.Position = CRT571_POSITION_IC
+	}
+	if steps.Position != CRT571_POSITION_IC && steps.Position != CRT571_POSITION_RF {
+		return nil, fmt.Errorf("%w: accept to %s", ErrIllegalMove, steps.Position)
+	}
+	if steps.PollInterval <= 0 {
+		steps.PollInterval = CRT571_DEFAULT_POLL_INTERVAL
+	}
+
+	if outcome.Status, err = service.StatusContext(ctx); err != nil {
+		return outcome, err
+	}
+	if outcome.Status.Card != CRT571_CARD_NONE {
+		return outcome, ErrCardInside
+	}
+
+	if _, err = service.CommandContext(ctx, CRT571_CM_CARD_ENTRY, CRT571_PM_CARD_ENTRY_ENABLE, nil); err != nil {
+		return outcome, err
+	}
+	defer func() {
+		// ctx may be already cancelled, entry must be disabled anyway
+		if _, err := service.CommandContext(context.WithoutCancel(ctx), CRT571_CM_CARD_ENTRY, CRT571_PM_CARD_ENTRY_DISABLE, nil); err != nil {
+			service.log.Error("AcceptReturnedCard(): disable card entry failed", "error", err)
+		}
+	}()
+
+	// Wait for card
+	ticker := time.NewTicker(steps.PollInterval)
+	defer ticker.Stop()
+	for outcome.Status.Card == CRT571_CARD_NONE {
+		select {
+		case <-ctx.Done():
+			return outcome, ctx.Err()
+		case <-ticker.C:
+		}
+		if outcome.Status, err = service.StatusContext(ctx); err != nil {
+			return outcome, err
+		}
+	}
+
+	if outcome.Status, err = service.MoveToContext(ctx, steps.Position); err != nil {
+		service.log.Error("AcceptReturnedCard(): move card failed", "position", steps.Position, "error", err)
+		service.captureReturnedCard(ctx, outcome, fmt.Sprintf("returned card move failed: %s", err))
+		return outcome, err
+	}
+
+	keep := false
+	if steps.Validate != nil {
+		keep, err = steps.Validate(ctx, service)
+	}
+	if err == nil && keep {
+		if outcome.Status, err = service.MoveToContext(ctx, CRT571_POSITION_HOLD); err != nil {
+			service.log.Error("AcceptReturnedCard(): keep card failed", "error", err)
+			service.captureReturnedCard(ctx, outcome, fmt.Sprintf("returned card keep failed: %s", err))
+			return outcome, err
+		}
+		outcome.Kept = true
+		return outcome, nil
+	}
+
+	reason := "returned card rejected"
+	if err != nil {
+		reason = fmt.Sprintf("returned card validation failed: %s", err)
+	}
+	service.captureReturnedCard(ctx, outcome, reason)
+	if err == nil {
+		err = outcome.CaptureErr
+	}
+	return outcome, err
+}
+
+// Capture returned card after failure or rejection
+func (service *CRT571Service) captureReturnedCard(ctx context.Context, outcome *CRT571AcceptOutcome, reason string) {
+	capture, status, err := service.captureLeftover(ctx, reason)
+	outcome.Capture = capture
+	if status.Card != CRT571_CARD_UNKNOWN {
+		outcome.Status = status
+	}
+	if err != nil {
+		outcome.CaptureErr = err
+		service.log.Error("AcceptReturnedCard(): capture failed", "error", err)
+		return
+	}
+	outcome.Captured = capture != nil
+}
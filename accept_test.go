@@ -0,0 +1,62 @@
+package crt571_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/syntech-pro/crt571"
+	"github.com/syntech-pro/crt571/simulator"
+)
+
+// Customer inserts card as soon as card entry is enabled
+func insertCard(ctx context.Context, dev *simulator.Device) {
+	for !dev.InsertCard() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestAcceptReturnedCardMoveFailure(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, ErrorBinCount: 3, Initialized: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go insertCard(ctx, dev)
+	dev.Fail(crt571.CRT571_CM_CARD_MOVE, "10")
+
+	outcome, err := service.AcceptReturnedCard(ctx, crt571.CRT571AcceptSteps{PollInterval: 5 * time.Millisecond})
+	if !errors.Is(err, crt571.ErrCardJam) {
+		t.Fatalf("AcceptReturnedCard() error: %v, want ErrCardJam", err)
+	}
+	if !outcome.Captured || outcome.CaptureErr != nil || outcome.Status.Card != crt571.CRT571_CARD_NONE {
+		t.Errorf("outcome %+v, want captured card", outcome)
+	}
+	if state := dev.State(); state.Position != simulator.PositionNone || state.ErrorBinCount != 4 || state.EntryEnabled {
+		t.Errorf("device state %+v, want card in error bin and entry disabled", state)
+	}
+}
+
+func TestAcceptReturnedCardKept(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go insertCard(ctx, dev)
+
+	validate := func(ctx context.Context, service *crt571.CRT571Service) (bool, error) {
+		return true, nil
+	}
+	outcome, err := service.AcceptReturnedCard(ctx, crt571.CRT571AcceptSteps{Validate: validate, PollInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("AcceptReturnedCard() error: %v", err)
+	}
+	if !outcome.Kept || outcome.Captured {
+		t.Errorf("outcome %+v, want kept card", outcome)
+	}
+	if state := dev.State(); state.Position != simulator.PositionHold || state.EntryEnabled {
+		t.Errorf("device state %+v, want card on holding position and entry disabled", state)
+	}
+}
@@ -0,0 +1,130 @@
+package crt571
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	CRT571_APDU_INS_GET_RESPONSE byte = 0xc0 // GET RESPONSE instruction
+	CRT571_APDU_MAX_EXCHANGES         = 64   // Exchanges of one TransmitAPDU (GET RESPONSE chain, Le correction)
+)
+
+// APDU is malformed
+var ErrAPDU = errors.New("crt571: invalid APDU")
+
+// ISO 7816-4 command APDU
+type CRT571CommandAPDU struct {
+	CLA, INS, P1, P2 byte
+	Data             []byte // Command data, Lc is its length
+	Le               int    // Expected response length 1-256 (1-65536 extended), 0 if absent
+	Extended         bool   // Use extended length fields, implied by Lc > 255 or Le > 256
+}
+
+// Encode command APDU (cases 1-4, short or extended)
+func (cmd *CRT571CommandAPDU) Bytes() ([]byte, error) {
+	lc := len(cmd.Data)
+	if lc > 65535 || cmd.Le < 0 || cmd.Le > 65536 {
+		return nil, fmt.Errorf("%w: Lc %d Le %d out of range", ErrAPDU, lc, cmd.Le)
+	}
+	extended := cmd.Extended || lc > 255 || cmd.Le > 256
+
+	apdu := []byte{cmd.CLA, cmd.INS, cmd.P1, cmd.P2}
+	if !extended {
+		if lc > 0 {
+			apdu = append(apdu, byte(lc))
+			apdu = append(apdu, cmd.Data...)
+		}
+		if cmd.Le > 0 {
+			apdu = append(apdu, byte(cmd.Le)) // 256 is encoded as 00
+		}
+		return apdu, nil
+	}
+
+	if lc > 0 {
+		apdu = append(apdu, 0, byte(lc>>8), byte(lc))
+		apdu = append(apdu, cmd.Data...)
+	}
+	if cmd.Le > 0 {
+		if lc == 0 {
+			apdu = append(apdu, 0)
+		}
+		apdu = append(apdu, byte(cmd.Le>>8), byte(cmd.Le)) // 65536 is encoded as 00 00
+	}
+	return apdu, nil
+}
+
+func (cmd *CRT571CommandAPDU) String() string {
+	return fmt.Sprintf("CLA:%02x INS:%02x P1:%02x P2:%02x Lc:%d Le:%d", cmd.CLA, cmd.INS, cmd.P1, cmd.P2, len(cmd.Data), cmd.Le)
+}
+
+// ISO 7816-4 response APDU
+type CRT571ResponseAPDU struct {
+	Data     []byte
+	SW1, SW2 byte
+}
+
+// Parse response APDU: DATA SW1 SW2
+func ParseResponseAPDU(data []byte) (*CRT571ResponseAPDU, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%w: response too short [% x]", ErrAPDU, data)
+	}
+	n := len(data) - 2
+	return &CRT571ResponseAPDU{Data: data[:n], SW1: data[n], SW2: data[n+1]}, nil
+}
+
+// Status word SW1SW2
+func (res *CRT571ResponseAPDU) SW() uint16 {
+	return uint16(res.SW1)<<8 | uint16(res.SW2)
+}
+
+// Normal processing, SW 9000
+func (res *CRT571ResponseAPDU) OK() bool {
+	return res.SW() == 0x9000
+}
+
+func (res *CRT571ResponseAPDU) String() string {
+	return fmt.Sprintf("SW:%04x data [% x]", res.SW(), res.Data)
+}
+
+// Exchange command APDU with transmit, handle T=0 procedure status words:
+// 61xx issues GET RESPONSE with Le=xx and concatenates response data,
+// 6Cxx re-sends command with Le=xx.
+func transmitAPDU(transmit func(apdu []byte) ([]byte, error), cmd CRT571CommandAPDU) (*CRT571ResponseAPDU, error) {
+	var data []byte
+	for i := 0; i < CRT571_APDU_MAX_EXCHANGES; i++ {
+		apdu, err := cmd.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := transmit(apdu)
+		if err != nil {
+			return nil, err
+		}
+		res, err := ParseResponseAPDU(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		switch res.SW1 {
+		case 0x61: // More data available
+			data = append(data, res.Data...)
+			// Logical channel of CLA is kept, secure messaging and chaining bits are not
+			cmd = CRT571CommandAPDU{CLA: cmd.CLA & 0x03, INS: CRT571_APDU_INS_GET_RESPONSE, Le: leOf(res.SW2)}
+		case 0x6c: // Wrong Le, SW2 is exact length
+			cmd.Le = leOf(res.SW2)
+		default:
+			res.Data = append(data, res.Data...)
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no final status word after %d exchanges", ErrAPDU, CRT571_APDU_MAX_EXCHANGES)
+}
+
+// Short Le from SW2, 00 means 256
+func leOf(sw2 byte) int {
+	if sw2 == 0 {
+		return 256
+	}
+	return int(sw2)
+}
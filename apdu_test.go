@@ -0,0 +1,145 @@
+package crt571
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCommandAPDUBytes(t *testing.T) {
+	data := bytes.Repeat([]byte{0x5a}, 300)
+	tests := []struct {
+		name string
+		cmd  CRT571CommandAPDU
+		want []byte
+	}{
+		{name: "case 1", cmd: CRT571CommandAPDU{CLA: 0x00, INS: 0xa4, P1: 0x04, P2: 0x00}, want: []byte{0x00, 0xa4, 0x04, 0x00}},
+		{name: "case 2", cmd: CRT571CommandAPDU{INS: 0xb0, Le: 0x10}, want: []byte{0x00, 0xb0, 0x00, 0x00, 0x10}},
+		{name: "case 2 Le 256", cmd: CRT571CommandAPDU{INS: 0xb0, Le: 256}, want: []byte{0x00, 0xb0, 0x00, 0x00, 0x00}},
+		{name: "case 3", cmd: CRT571CommandAPDU{INS: 0xd6, Data: []byte{1, 2}}, want: []byte{0x00, 0xd6, 0x00, 0x00, 0x02, 1, 2}},
+		{name: "case 4", cmd: CRT571CommandAPDU{INS: 0xa4, P1: 0x04, Data: []byte{0xa0, 0x00}, Le: 256}, want: []byte{0x00, 0xa4, 0x04, 0x00, 0x02, 0xa0, 0x00, 0x00}},
+		{name: "extended case 2", cmd: CRT571CommandAPDU{INS: 0xb0, Le: 257}, want: []byte{0x00, 0xb0, 0x00, 0x00, 0x00, 0x01, 0x01}},
+		{name: "extended case 2 Le 65536", cmd: CRT571CommandAPDU{INS: 0xb0, Le: 65536}, want: []byte{0x00, 0xb0, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "extended flag", cmd: CRT571CommandAPDU{INS: 0xb0, Le: 0x10, Extended: true}, want: []byte{0x00, 0xb0, 0x00, 0x00, 0x00, 0x00, 0x10}},
+		{name: "extended case 3", cmd: CRT571CommandAPDU{INS: 0xd6, Data: data}, want: append([]byte{0x00, 0xd6, 0x00, 0x00, 0x00, 0x01, 0x2c}, data...)},
+		{name: "extended case 4", cmd: CRT571CommandAPDU{INS: 0xd6, Data: data, Le: 2}, want: append(append([]byte{0x00, 0xd6, 0x00, 0x00, 0x00, 0x01, 0x2c}, data...), 0x00, 0x02)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cmd.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes() error: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Bytes() = [% x], want [% x]", got, tt.want)
+			}
+		})
+	}
+
+	for _, cmd := range []CRT571CommandAPDU{{Le: -1}, {Le: 65537}, {Data: make([]byte, 65536)}} {
+		if _, err := cmd.Bytes(); !errors.Is(err, ErrAPDU) {
+			t.Errorf("%s: Bytes() error: %v, want ErrAPDU", &cmd, err)
+		}
+	}
+}
+
+// Scripted card: returns responses in order, records command APDUs
+type testAPDUCard struct {
+	responses [][]byte
+	commands  [][]byte
+}
+
+func (card *testAPDUCard) transmit(apdu []byte) ([]byte, error) {
+	card.commands = append(card.commands, apdu)
+	if len(card.responses) == 0 {
+		return []byte{0x6f, 0x00}, nil
+	}
+	res := card.responses[0]
+	card.responses = card.responses[1:]
+	return res, nil
+}
+
+func TestTransmitAPDU(t *testing.T) {
+	tests := []struct {
+		name      string
+		cmd       CRT571CommandAPDU
+		responses [][]byte
+		commands  [][]byte
+		data      []byte
+		sw        uint16
+	}{
+		{
+			name:      "no chaining",
+			cmd:       CRT571CommandAPDU{INS: 0xb0, Le: 2},
+			responses: [][]byte{{1, 2, 0x90, 0x00}},
+			commands:  [][]byte{{0x00, 0xb0, 0x00, 0x00, 0x02}},
+			data:      []byte{1, 2},
+			sw:        0x9000,
+		},
+		{
+			name:      "61xx chain",
+			cmd:       CRT571CommandAPDU{CLA: 0x8c, INS: 0xa4, P1: 0x04, Data: []byte{0xa0}},
+			responses: [][]byte{{0x61, 0x02}, {1, 2, 0x61, 0x00}, {3, 0x90, 0x00}},
+			commands: [][]byte{
+				{0x8c, 0xa4, 0x04, 0x00, 0x01, 0xa0},
+				{0x00, CRT571_APDU_INS_GET_RESPONSE, 0x00, 0x00, 0x02}, // Secure messaging bits of CLA cleared
+				{0x00, CRT571_APDU_INS_GET_RESPONSE, 0x00, 0x00, 0x00}, // 61 00: 256 bytes
+			},
+			data: []byte{1, 2, 3},
+			sw:   0x9000,
+		},
+		{
+			name:      "61xx chain on logical channel",
+			cmd:       CRT571CommandAPDU{CLA: 0x03, INS: 0xca},
+			responses: [][]byte{{0x61, 0x01}, {7, 0x90, 0x00}},
+			commands:  [][]byte{{0x03, 0xca, 0x00, 0x00}, {0x03, CRT571_APDU_INS_GET_RESPONSE, 0x00, 0x00, 0x01}},
+			data:      []byte{7},
+			sw:        0x9000,
+		},
+		{
+			name:      "6Cxx Le retry",
+			cmd:       CRT571CommandAPDU{CLA: 0x80, INS: 0xca, P1: 0x9f, P2: 0x7f, Le: 256},
+			responses: [][]byte{{0x6c, 0x03}, {1, 2, 3, 0x90, 0x00}},
+			commands:  [][]byte{{0x80, 0xca, 0x9f, 0x7f, 0x00}, {0x80, 0xca, 0x9f, 0x7f, 0x03}},
+			data:      []byte{1, 2, 3},
+			sw:        0x9000,
+		},
+		{
+			name:      "error status after chain",
+			cmd:       CRT571CommandAPDU{INS: 0xb0},
+			responses: [][]byte{{1, 0x61, 0x01}, {0x6a, 0x82}},
+			commands:  [][]byte{{0x00, 0xb0, 0x00, 0x00}, {0x00, CRT571_APDU_INS_GET_RESPONSE, 0x00, 0x00, 0x01}},
+			data:      []byte{1},
+			sw:        0x6a82,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := &testAPDUCard{responses: tt.responses}
+			res, err := transmitAPDU(card.transmit, tt.cmd)
+			if err != nil {
+				t.Fatalf("transmitAPDU() error: %v", err)
+			}
+			if !bytes.Equal(res.Data, tt.data) || res.SW() != tt.sw {
+				t.Errorf("transmitAPDU() = %s, want SW:%04x data [% x]", res, tt.sw, tt.data)
+			}
+			if len(card.commands) != len(tt.commands) {
+				t.Fatalf("sent %d command APDUs, want %d", len(card.commands), len(tt.commands))
+			}
+			for i, command := range card.commands {
+				if !bytes.Equal(command, tt.commands[i]) {
+					t.Errorf("command APDU %d = [% x], want [% x]", i, command, tt.commands[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTransmitAPDUEndlessChain(t *testing.T) {
+	transmit := func(apdu []byte) ([]byte, error) {
+		return []byte{0x61, 0x01}, nil
+	}
+	if _, err := transmitAPDU(transmit, CRT571CommandAPDU{INS: 0xb0}); !errors.Is(err, ErrAPDU) {
+		t.Errorf("transmitAPDU() error: %v, want ErrAPDU", err)
+	}
+}
@@ -0,0 +1,130 @@
+package crt571
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ATR initial character TS
+const (
+	CRT571_ATR_TS_DIRECT  byte = 0x3b // Direct convention
+	CRT571_ATR_TS_INVERSE byte = 0x3f // Inverse convention
+)
+
+// Answer to reset is malformed or its check byte is wrong
+var ErrATR = errors.New("crt571: invalid ATR")
+
+// ISO 7816-3 answer to reset
+type CRT571ATR struct {
+	Raw        []byte
+	TS         byte
+	Protocols  []int  // Protocols T offered in TD1, TD2..., empty means T=0 only
+	TA1        int    // Fi/Di, -1 if absent
+	TB1        int    // Programming voltage (deprecated), -1 if absent
+	TC1        int    // Extra guard time N, -1 if absent
+	Historical []byte // Historical bytes T1...TK
+	TCK        int    // Check byte, -1 if absent
+}
+
+// Parse ISO 7816-3 ATR: TS T0 {TAi TBi TCi TDi} T1...TK [TCK].
+// TCK is present and checked unless only T=0 is offered.
+func ParseATR(data []byte) (*CRT571ATR, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%w: too short [% x]", ErrATR, data)
+	}
+	atr := &CRT571ATR{Raw: data, TS: data[0], TA1: -1, TB1: -1, TC1: -1, TCK: -1}
+	if atr.TS != CRT571_ATR_TS_DIRECT && atr.TS != CRT571_ATR_TS_INVERSE {
+		return nil, fmt.Errorf("%w: bad TS %02x", ErrATR, atr.TS)
+	}
+
+	k := int(data[1] & 0x0f)
+	y := data[1] >> 4
+	pos := 2
+	tck := false
+	for i := 1; ; i++ {
+		for bit, field := range []*int{&atr.TA1, &atr.TB1, &atr.TC1} {
+			if y&(1<<bit) == 0 {
+				continue
+			}
+			if pos >= len(data) {
+				return nil, fmt.Errorf("%w: truncated interface bytes [% x]", ErrATR, data)
+			}
+			if i == 1 {
+				*field = int(data[pos])
+			}
+			pos++
+		}
+		if y&0x08 == 0 {
+			break
+		}
+		if pos >= len(data) {
+			return nil, fmt.Errorf("%w: truncated interface bytes [% x]", ErrATR, data)
+		}
+		td := data[pos]
+		pos++
+		atr.Protocols = append(atr.Protocols, int(td&0x0f))
+		if td&0x0f != 0 {
+			tck = true
+		}
+		y = td >> 4
+	}
+
+	if pos+k > len(data) {
+		return nil, fmt.Errorf("%w: truncated historical bytes [% x]", ErrATR, data)
+	}
+	atr.Historical = data[pos : pos+k]
+	pos += k
+
+	if tck {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("%w: missing TCK [% x]", ErrATR, data)
+		}
+		atr.TCK = int(data[pos])
+		check := byte(0)
+		for _, b := range data[1 : pos+1] {
+			check ^= b
+		}
+		if check != 0 {
+			return nil, fmt.Errorf("%w: TCK %02x mismatch [% x]", ErrATR, atr.TCK, data)
+		}
+		pos++
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("%w: %d extra bytes [% x]", ErrATR, len(data)-pos, data)
+	}
+	return atr, nil
+}
+
+// Parse ATR of CPU card/SAM reset response. Response data may start with
+// card protocol type '0'/'1' before ATR (TS is never 0x30/0x31).
+func parseResetATR(data []byte) (*CRT571ATR, error) {
+	if len(data) > 0 && (data[0] == '0' || data[0] == '1') {
+		data = data[1:]
+	}
+	return ParseATR(data)
+}
+
+// Protocol used after reset without PPS: first offered protocol, T=0 if none
+func (atr *CRT571ATR) Protocol() int {
+	if len(atr.Protocols) == 0 {
+		return 0
+	}
+	return atr.Protocols[0]
+}
+
+// Card offers protocol T=t
+func (atr *CRT571ATR) Supports(t int) bool {
+	if len(atr.Protocols) == 0 {
+		return t == 0
+	}
+	for _, p := range atr.Protocols {
+		if p == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (atr *CRT571ATR) String() string {
+	return fmt.Sprintf("ATR [% x] T=%d historical [% x]", atr.Raw, atr.Protocol(), atr.Historical)
+}
@@ -0,0 +1,117 @@
+package crt571
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// ATR with TCK appended: XOR of T0...TK
+func testATR(data ...byte) []byte {
+	check := byte(0)
+	for _, b := range data[1:] {
+		check ^= b
+	}
+	return append(data, check)
+}
+
+func TestParseATR(t *testing.T) {
+	t1 := testATR(0x3b, 0x81, 0x81, 0x31, 0xfe, 0x45, 'x') // TD1 T=1, TD2 T=1 with TA3 TB3
+	wrongTCK := bytes.Clone(t1)
+	wrongTCK[len(wrongTCK)-1] ^= 0xff
+
+	tests := []struct {
+		name       string
+		data       []byte
+		err        bool
+		ts         byte
+		protocols  []int
+		ta1        int
+		tb1        int
+		tc1        int
+		historical []byte
+		tck        int
+	}{
+		{name: "T=0 without TCK", data: []byte{0x3b, 0x02, 0x14, 0x50}, ts: CRT571_ATR_TS_DIRECT, ta1: -1, tb1: -1, tc1: -1, historical: []byte{0x14, 0x50}, tck: -1},
+		{name: "TA1 TB1 TC1", data: []byte{0x3b, 0x72, 0x96, 0x00, 0xff, 'A', 'B'}, ts: CRT571_ATR_TS_DIRECT, ta1: 0x96, tb1: 0x00, tc1: 0xff, historical: []byte("AB"), tck: -1},
+		{name: "T=1 first", data: t1, ts: CRT571_ATR_TS_DIRECT, protocols: []int{1, 1}, ta1: -1, tb1: -1, tc1: -1, historical: []byte("x"), tck: int(t1[len(t1)-1])},
+		{name: "T=0 then T=1", data: testATR(0x3b, 0x80, 0x80, 0x01), ts: CRT571_ATR_TS_DIRECT, protocols: []int{0, 1}, ta1: -1, tb1: -1, tc1: -1, historical: []byte{}, tck: 0x01},
+		{name: "inverse convention", data: []byte{0x3f, 0x10, 0x11}, ts: CRT571_ATR_TS_INVERSE, ta1: 0x11, tb1: -1, tc1: -1, historical: []byte{}, tck: -1},
+		{name: "wrong TCK", data: wrongTCK, err: true},
+		{name: "missing TCK", data: t1[:len(t1)-1], err: true},
+		{name: "extra byte", data: []byte{0x3b, 0x00, 0x00}, err: true},
+		{name: "bad TS", data: []byte{0x3a, 0x00}, err: true},
+		{name: "too short", data: []byte{0x3b}, err: true},
+		{name: "truncated TA1", data: []byte{0x3b, 0x70, 0x96}, err: true},
+		{name: "truncated TD1", data: []byte{0x3b, 0x80}, err: true},
+		{name: "truncated historical bytes", data: []byte{0x3b, 0x05, 0x01, 0x02}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atr, err := ParseATR(tt.data)
+			if tt.err {
+				if !errors.Is(err, ErrATR) {
+					t.Fatalf("ParseATR([% x]) error: %v, want ErrATR", tt.data, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseATR([% x]) error: %v", tt.data, err)
+			}
+			if atr.TS != tt.ts || !slices.Equal(atr.Protocols, tt.protocols) || atr.TA1 != tt.ta1 || atr.TB1 != tt.tb1 || atr.TC1 != tt.tc1 ||
+				!bytes.Equal(atr.Historical, tt.historical) || atr.TCK != tt.tck {
+				t.Errorf("ParseATR([% x]) = %+v", tt.data, atr)
+			}
+		})
+	}
+}
+
+func TestATRProtocol(t *testing.T) {
+	atr, err := ParseATR(testATR(0x3b, 0x81, 0x81, 0x31, 0xfe, 0x45, 'x'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atr.Protocol() != 1 || !atr.Supports(1) || atr.Supports(0) {
+		t.Errorf("T=1 ATR: Protocol() = %d, Supports(1) = %t, Supports(0) = %t", atr.Protocol(), atr.Supports(1), atr.Supports(0))
+	}
+
+	if atr, err = ParseATR([]byte{0x3b, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	if atr.Protocol() != 0 || !atr.Supports(0) || atr.Supports(1) {
+		t.Errorf("T=0 ATR: Protocol() = %d, Supports(0) = %t, Supports(1) = %t", atr.Protocol(), atr.Supports(0), atr.Supports(1))
+	}
+}
+
+func TestParseResetATR(t *testing.T) {
+	t1 := testATR(0x3b, 0x81, 0x81, 0x31, 0xfe, 0x45, 'x')
+	tests := []struct {
+		name string
+		data []byte
+		atr  []byte // ATR after protocol type, nil if invalid
+	}{
+		{name: "T=0 prefix", data: []byte{'0', 0x3b, 0x02, 0x14, 0x50}, atr: []byte{0x3b, 0x02, 0x14, 0x50}},
+		{name: "T=1 prefix", data: append([]byte{'1'}, t1...), atr: t1},
+		{name: "no prefix", data: t1, atr: t1},
+		{name: "prefix only", data: []byte{'1'}},
+		{name: "empty", data: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atr, err := parseResetATR(tt.data)
+			if tt.atr == nil {
+				if !errors.Is(err, ErrATR) {
+					t.Fatalf("parseResetATR([% x]) error: %v, want ErrATR", tt.data, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseResetATR([% x]) error: %v", tt.data, err)
+			}
+			if !bytes.Equal(atr.Raw, tt.atr) {
+				t.Errorf("parseResetATR([% x]) = %s, want [% x]", tt.data, atr, tt.atr)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package crt571
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Card is still in device after capture
+var ErrCaptureFailed = errors.New("crt571: card was not captured")
+
+type CRT571CaptureResult struct {
+	Reason         string
+	BinCountBefore int // Error card bin counter before capture, -1 if unknown
+	BinCountAfter  int // Error card bin counter after capture, -1 if unknown
+	Status         CRT571DeviceStatus
+	Time           time.Time
+}
+
+func (result *CRT571CaptureResult) String() string {
+	return fmt.Sprintf("card captured (%s), error bin counter %d -> %d", result.Reason, result.BinCountBefore, result.BinCountAfter)
+}
+
+// Capture (swallow) card from gate or RF/IC position to error card bin,
+// verify that card left the device and read error card bin counter before
+// and after for audit. Counter read failures do not fail capture, counter is -1 then.
+func (service *CRT571Service) Capture(ctx context.Context, reason string) (*CRT571CaptureResult, error) {
+	result := &CRT571CaptureResult{Reason: reason, BinCountBefore: -1, BinCountAfter: -1, Time: time.Now()}
+
+	count, err := service.ErrorBinCountContext(ctx)
+	if err != nil {
+		service.log.Warn("Capture(): read error bin counter failed", "error", err)
+	} else {
+		result.BinCountBefore = count
+	}
+
+	if _, err = service.MoveToContext(ctx, CRT571_POSITION_ERROR_BIN); err != nil {
+		return result, err
+	}
+
+	if result.Status, err = service.StatusContext(ctx); err != nil {
+		return result, err
+	}
+	if result.Status.Card != CRT571_CARD_NONE {
+		return result, fmt.Errorf("%w: %s", ErrCaptureFailed, result.Status.Card)
+	}
+
+	count, err = service.ErrorBinCountContext(ctx)
+	if err != nil {
+		service.log.Warn("Capture(): read error bin counter failed", "error", err)
+	} else {
+		result.BinCountAfter = count
+	}
+
+	service.log.Info("Capture(): card captured", "reason", reason, "before", result.BinCountBefore, "after", result.BinCountAfter)
+	return result, nil
+}
+
+// Capture card left in device after failed workflow. ctx may be already
+// cancelled, card is captured anyway. Returns nil result if there is no card
+// inside and last device status, zero status if it is unknown.
+func (service *CRT571Service) captureLeftover(ctx context.Context, reason string) (*CRT571CaptureResult, CRT571DeviceStatus, error) {
+	ctx = context.WithoutCancel(ctx)
+
+	status, err := service.StatusContext(ctx)
+	if err == nil && status.Card == CRT571_CARD_NONE {
+		return nil, status, nil
+	}
+
+	result, err := service.Capture(ctx, reason)
+	if err != nil {
+		if result.Status.Card != CRT571_CARD_UNKNOWN {
+			status = result.Status
+		}
+		return result, status, err
+	}
+	return result, result.Status, nil
+}
+
+// Read error card bin counter
+func (service *CRT571Service) ErrorBinCount() (int, error) {
+	return service.ErrorBinCountContext(context.Background())
+}
+
+// Read error card bin counter with context
+func (service *CRT571Service) ErrorBinCountContext(ctx context.Context) (int, error) {
+	res, err := service.CommandContext(ctx, CRT571_CM_RECYCLEBIN_COUNTER, CRT571_PM_RECYCLEBIN_COUNTER_READ, nil)
+	if err != nil {
+		return 0, err
+	}
+	return parseBinCounter(res.Data)
+}
+
+// Counter is ASCII decimal digits, binary big endian value is accepted too
+func parseBinCounter(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w: empty error bin counter", ErrProtocol)
+	}
+	if count, err := strconv.Atoi(string(data)); err == nil {
+		return count, nil
+	}
+	if len(data) > 4 {
+		return 0, fmt.Errorf("%w: bad error bin counter [% x]", ErrProtocol, data)
+	}
+	count := 0
+	for _, b := range data {
+		count = count<<8 | int(b)
+	}
+	return count, nil
+}
@@ -0,0 +1,70 @@
+package crt571
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	count, st0 := 5, CRT571_ST0_ONE_CARD_ON_POSITION
+	service := newTestService(t, func(cm, pm byte, data []byte) []byte {
+		switch cm {
+		case CRT571_CM_CARD_MOVE:
+			count++
+			st0 = CRT571_ST0_NO_CARD
+		case CRT571_CM_RECYCLEBIN_COUNTER:
+			return testPositive(cm, pm, st0, []byte(fmt.Sprintf("%03d", count))...)
+		}
+		return testPositive(cm, pm, st0)
+	})
+
+	result, err := service.Capture(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Capture() error: %v", err)
+	}
+	if result.BinCountBefore != 5 || result.BinCountAfter != 6 || result.Status.Card != CRT571_CARD_NONE || result.Reason != "test" {
+		t.Errorf("Capture() = %s, status %s", result, result.Status)
+	}
+}
+
+func TestCaptureFailed(t *testing.T) {
+	service := newTestService(t, func(cm, pm byte, data []byte) []byte {
+		if cm == CRT571_CM_RECYCLEBIN_COUNTER {
+			return []byte{CRT571_EMT2, cm, pm, '0', '3'}
+		}
+		// Card stays on position
+		return testPositive(cm, pm, CRT571_ST0_ONE_CARD_ON_POSITION)
+	})
+
+	result, err := service.Capture(context.Background(), "test")
+	if !errors.Is(err, ErrCaptureFailed) {
+		t.Fatalf("Capture() error: %v, want ErrCaptureFailed", err)
+	}
+	// Counter read failure does not fail capture
+	if result.BinCountBefore != -1 || result.BinCountAfter != -1 || result.Status.Card != CRT571_CARD_ON_POSITION {
+		t.Errorf("Capture() = %s, status %s", result, result.Status)
+	}
+}
+
+func TestParseBinCounter(t *testing.T) {
+	for _, tc := range []struct {
+		data  []byte
+		count int
+		err   error
+	}{
+		{[]byte("007"), 7, nil},
+		{[]byte("120"), 120, nil},
+		{[]byte{0x00, 0x2a}, 42, nil},
+		{[]byte{0x01, 0x02}, 258, nil},
+		{[]byte{0x05}, 5, nil},
+		{nil, 0, ErrProtocol},
+		{[]byte{1, 2, 3, 4, 5}, 0, ErrProtocol},
+	} {
+		count, err := parseBinCounter(tc.data)
+		if count != tc.count || !errors.Is(err, tc.err) || (tc.err == nil) != (err == nil) {
+			t.Errorf("parseBinCounter([% x]) = %d, %v, want %d, %v", tc.data, count, err, tc.count, tc.err)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package crt571
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Card technology detected by CARD_TYPE command
+type CRT571CardKind int
+
+const (
+	CRT571_CARD_KIND_UNKNOWN           CRT571CardKind = iota
+	CRT571_CARD_KIND_T0_CPU                           // T=0 CPU card
+	CRT571_CARD_KIND_T1_CPU                           // T=1 CPU card
+	CRT571_CARD_KIND_SLE4442                          // SLE4442 memory card
+	CRT571_CARD_KIND_SLE4428                          // SLE4428 memory card
+	CRT571_CARD_KIND_24CXX                            // 24C01-24C256 IIC memory card
+	CRT571_CARD_KIND_MIFARE_1K                        // Mifare Classic 1K (S50)
+	CRT571_CARD_KIND_MIFARE_4K                        // Mifare Classic 4K (S70)
+	CRT571_CARD_KIND_MIFARE_ULTRALIGHT                // Mifare UltraLight
+	CRT571_CARD_KIND_TYPE_A_TCL                       // Type A T=CL CPU card
+	CRT571_CARD_KIND_TYPE_B_TCL                       // Type B T=CL CPU card
+)
+
+// Card kinds by data of IC card type check (CARD_TYPE, PM=CRT571_PM_CARD_TYPE_IC)
+var CRT571ICCardTypes = map[string]CRT571CardKind{
+	"10": CRT571_CARD_KIND_T0_CPU,
+	"11": CRT571_CARD_KIND_T1_CPU,
+	"20": CRT571_CARD_KIND_SLE4442,
+	"21": CRT571_CARD_KIND_SLE4428,
+	"30": CRT571_CARD_KIND_24CXX, // 24C01
+	"31": CRT571_CARD_KIND_24CXX, // 24C02
+	"32": CRT571_CARD_KIND_24CXX, // 24C04
+	"33": CRT571_CARD_KIND_24CXX, // 24C08
+	"34": CRT571_CARD_KIND_24CXX, // 24C16
+	"35": CRT571_CARD_KIND_24CXX, // 24C32
+	"36": CRT571_CARD_KIND_24CXX, // 24C64
+	"37": CRT571_CARD_KIND_24CXX, // 24C128
+	"38": CRT571_CARD_KIND_24CXX, // 24C256
+}
+
+// Memory size in bytes of 24Cxx cards by data of IC card type check
+var CRT571IICCardSizes = map[string]int{
+	"30": 128,
+	"31": 256,
+	"32": 512,
+	"33": 1024,
+	"34": 2048,
+	"35": 4096,
+	"36": 8192,
+	"37": 16384,
+	"38": 32768,
+}
+
+// Card kinds by data of RF card type check (CARD_TYPE, PM=CRT571_PM_CARD_TYPE_RF)
+var CRT571RFCardTypes = map[string]CRT571CardKind{
+	"10": CRT571_CARD_KIND_MIFARE_1K,
+	"11": CRT571_CARD_KIND_MIFARE_4K,
+	"12": CRT571_CARD_KIND_MIFARE_ULTRALIGHT,
+	"20": CRT571_CARD_KIND_TYPE_A_TCL,
+	"21": CRT571_CARD_KIND_TYPE_B_TCL,
+}
+
+func (kind CRT571CardKind) String() string {
+	switch kind {
+	case CRT571_CARD_KIND_T0_CPU:
+		return "T=0 CPU card"
+	case CRT571_CARD_KIND_T1_CPU:
+		return "T=1 CPU card"
+	case CRT571_CARD_KIND_SLE4442:
+		return "SLE4442 card"
+	case CRT571_CARD_KIND_SLE4428:
+		return "SLE4428 card"
+	case CRT571_CARD_KIND_24CXX:
+		return "24Cxx card"
+	case CRT571_CARD_KIND_MIFARE_1K:
+		return "Mifare Classic 1K card"
+	case CRT571_CARD_KIND_MIFARE_4K:
+		return "Mifare Classic 4K card"
+	case CRT571_CARD_KIND_MIFARE_ULTRALIGHT:
+		return "Mifare UltraLight card"
+	case CRT571_CARD_KIND_TYPE_A_TCL:
+		return "Type A T=CL card"
+	case CRT571_CARD_KIND_TYPE_B_TCL:
+		return "Type B T=CL card"
+	}
+	return "unknown card"
+}
+
+// Card on RF/IC card position. Concrete handle type exposes operations
+// of the card family: *CRT571CPUCard, *CRT571SLE4442, *CRT571SLE4428,
+// *CRT571IICCard, *CRT571MifareCard, *CRT571TCLCard or *CRT571UnknownCard.
+// Operations without ctx are queued with priority of DetectCardContext ctx,
+// ...Context variants run with their own ctx.
+type CRT571Card interface {
+	Kind() CRT571CardKind
+}
+
+// Card handle base
+type cardHandle struct {
+	handlePriority
+	service *CRT571Service
+	kind    CRT571CardKind
+}
+
+func (card *cardHandle) Kind() CRT571CardKind {
+	return card.kind
+}
+
+// Card command, returns response data
+func (card *cardHandle) command(ctx context.Context, cm, pm byte, data []byte) ([]byte, error) {
+	res, err := card.service.CommandContext(ctx, cm, pm, data)
+	if err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
+
+// Detect card on RF/IC card position: IC card type check, then RF card type check
+func (service *CRT571Service) DetectCard() (CRT571Card, error) {
+	return service.DetectCardContext(context.Background())
+}
+
+// Detect card on RF/IC card position with context. Priority of ctx is kept
+// for operations of returned handle, its deadline is not.
+func (service *CRT571Service) DetectCardContext(ctx context.Context) (CRT571Card, error) {
+	kind, code, err := service.detectCardKind(ctx, CRT571_PM_CARD_TYPE_IC, CRT571ICCardTypes)
+	if err == nil && kind == CRT571_CARD_KIND_UNKNOWN {
+		kind, code, err = service.detectCardKind(ctx, CRT571_PM_CARD_TYPE_RF, CRT571RFCardTypes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	service.log.Debug("DetectCard(): card detected", "kind", kind, "code", code)
+
+	handle := cardHandle{handlePriority: newHandlePriority(ctx), service: service, kind: kind}
+	switch kind {
+	case CRT571_CARD_KIND_T0_CPU, CRT571_CARD_KIND_T1_CPU:
+		return &CRT571CPUCard{cardHandle: handle}, nil
+	case CRT571_CARD_KIND_SLE4442:
+		return &CRT571SLE4442{cardHandle: handle}, nil
+	case CRT571_CARD_KIND_SLE4428:
+		return &CRT571SLE4428{cardHandle: handle}, nil
+	case CRT571_CARD_KIND_24CXX:
+		return &CRT571IICCard{cardHandle: handle, size: CRT571IICCardSizes[code]}, nil
+	case CRT571_CARD_KIND_MIFARE_1K, CRT571_CARD_KIND_MIFARE_4K, CRT571_CARD_KIND_MIFARE_ULTRALIGHT:
+		return &CRT571MifareCard{cardHandle: handle}, nil
+	case CRT571_CARD_KIND_TYPE_A_TCL, CRT571_CARD_KIND_TYPE_B_TCL:
+		return &CRT571TCLCard{cardHandle: handle}, nil
+	}
+	return &CRT571UnknownCard{cardHandle: handle}, nil
+}
+
+// Card type check. Device errors of card without chip of checked family
+// (activation false, command out of IC card support) mean unknown kind,
+// other errors (not reset, no card on position, card jam...) are returned.
+func (service *CRT571Service) detectCardKind(ctx context.Context, pm byte, types map[string]CRT571CardKind) (CRT571CardKind, string, error) {
+	res, err := service.CommandContext(ctx, CRT571_CM_CARD_TYPE, pm, nil)
+	if errors.Is(err, ErrCardActivation) || errors.Is(err, ErrICCommandUnsupported) {
+		service.log.Debug("DetectCard(): no chip", "pm", hexByte(pm), "error", err)
+		return CRT571_CARD_KIND_UNKNOWN, "", nil
+	}
+	if err != nil {
+		return CRT571_CARD_KIND_UNKNOWN, "", err
+	}
+	code := string(res.Data)
+	return types[code], code, nil
+}
+
+// Reset SLE4442/4428 card
+func (card *cardHandle) sleReset(ctx context.Context) ([]byte, error) {
+	return card.command(ctx, CRT571_CM_SLE4442_4428_CARD_CONTROL, CRT571_PM_SLE4442_4428_CARD_CONTROL_RESET, nil)
+}
+
+// Power down SLE4442/4428 card
+func (card *cardHandle) slePowerDown(ctx context.Context) error {
+	_, err := card.command(ctx, CRT571_CM_SLE4442_4428_CARD_CONTROL, CRT571_PM_SLE4442_4428_CARD_CONTROL_POWER_DOWN, nil)
+	return err
+}
+
+// SLE4442/4428 card status
+func (card *cardHandle) sleStatus(ctx context.Context) ([]byte, error) {
+	return card.command(ctx, CRT571_CM_SLE4442_4428_CARD_CONTROL, CRT571_PM_SLE4442_4428_CARD_CONTROL_CARD_STATUS, nil)
+}
+
+// SLE4442/4428 card operation: sub-command and its parameters
+func (card *cardHandle) sleOperate(ctx context.Context, pm, sub byte, params ...byte) ([]byte, error) {
+	return card.command(ctx, CRT571_CM_SLE4442_4428_CARD_CONTROL, pm, append([]byte{sub}, params...))
+}
+
+// Verify PSC of SLE4442/4428 card guarded by error counter: locked card and,
+// unless forced, last attempt are refused. Card restores error counter to
+// max attempts on success only.
+func (card *cardHandle) sleVerifyPSC(readCounter func() (int, error), verify func() error, max int, force bool) error {
+	attempts, err := readCounter()
+	if err != nil {
+		return err
+	}
+	if attempts == 0 {
+		return ErrPSCLocked
+	}
+	if attempts == 1 && !force {
+		return ErrPSCLastAttempt
+	}
+
+	if err = verify(); err != nil {
+		return err
+	}
+
+	if attempts, err = readCounter(); err != nil {
+		return err
+	}
+	if attempts < max {
+		card.service.log.Warn("PSC verification failed", "card", card.kind, "attempts", attempts)
+		return fmt.Errorf("%w: %d attempts left", ErrPSCMismatch, attempts)
+	}
+	return nil
+}
+
+// 24C01-24C256 IIC memory card
+type CRT571IICCard struct {
+	cardHandle
+	size int
+}
+
+// Memory size in bytes from card type check, e.g. 2048 for 24C16
+func (card *CRT571IICCard) Size() int {
+	return card.size
+}
+
+// Reset IIC card
+func (card *CRT571IICCard) Reset() ([]byte, error) {
+	return card.ResetContext(card.background())
+}
+
+// Reset IIC card with context
+func (card *CRT571IICCard) ResetContext(ctx context.Context) ([]byte, error) {
+	return card.command(ctx, CRT571_CM_IIC_MEMORYCARD, CRT571_PM_IIC_MEMORYCARD_RESET, nil)
+}
+
+// Power down IIC card
+func (card *CRT571IICCard) Close() error {
+	return card.CloseContext(card.background())
+}
+
+// Power down IIC card with context
+func (card *CRT571IICCard) CloseContext(ctx context.Context) error {
+	_, err := card.command(ctx, CRT571_CM_IIC_MEMORYCARD, CRT571_PM_IIC_MEMORYCARD_POWER_DOWN, nil)
+	return err
+}
+
+// Read n bytes from addr. Command data: ADDRH ADDRL LEN
+func (card *CRT571IICCard) Read(addr uint16, n int) ([]byte, error) {
+	return card.ReadContext(card.background(), addr, n)
+}
+
+// Read n bytes from addr with context
+func (card *CRT571IICCard) ReadContext(ctx context.Context, addr uint16, n int) ([]byte, error) {
+	if n <= 0 || n > 0xff {
+		return nil, fmt.Errorf("crt571: IIC card read length %d out of range 1-255", n)
+	}
+	if err := card.checkRange(addr, n); err != nil {
+		return nil, err
+	}
+	data := binary.BigEndian.AppendUint16(nil, addr)
+	return card.command(ctx, CRT571_CM_IIC_MEMORYCARD, CRT571_PM_IIC_MEMORYCARD_READ, append(data, byte(n)))
+}
+
+// Write data to addr. Command data: ADDRH ADDRL LEN DATA
+func (card *CRT571IICCard) Write(addr uint16, data []byte) error {
+	return card.WriteContext(card.background(), addr, data)
+}
+
+// Write data to addr with context
+func (card *CRT571IICCard) WriteContext(ctx context.Context, addr uint16, data []byte) error {
+	if len(data) == 0 || len(data) > 0xff {
+		return fmt.Errorf("crt571: IIC card write length %d out of range 1-255", len(data))
+	}
+	if err := card.checkRange(addr, len(data)); err != nil {
+		return err
+	}
+	cmd := binary.BigEndian.AppendUint16(nil, addr)
+	cmd = append(cmd, byte(len(data)))
+	_, err := card.command(ctx, CRT571_CM_IIC_MEMORYCARD, CRT571_PM_IIC_MEMORYCARD_WRITE, append(cmd, data...))
+	return err
+}
+
+func (card *CRT571IICCard) checkRange(addr uint16, n int) error {
+	if int(addr)+n > card.size {
+		return fmt.Errorf("%w: %d bytes at %d, card size %d", ErrCardAddress, n, addr, card.size)
+	}
+	return nil
+}
+
+// Mifare Classic or UltraLight card
+type CRT571MifareCard struct {
+	cardHandle
+}
+
+// Activate RF card, returns card data (UID)
+func (card *CRT571MifareCard) Activate() ([]byte, error) {
+	return card.ActivateContext(card.background())
+}
+
+// Activate RF card with context
+func (card *CRT571MifareCard) ActivateContext(ctx context.Context) ([]byte, error) {
+	return card.command(ctx, CRT571_CM_RFCARD_CONTROL, CRT571_PM_RFCARD_CONTROL_STARTUP, nil)
+}
+
+// Power down RF card
+func (card *CRT571MifareCard) Close() error {
+	return card.CloseContext(card.background())
+}
+
+// Power down RF card with context
+func (card *CRT571MifareCard) CloseContext(ctx context.Context) error {
+	_, err := card.command(ctx, CRT571_CM_RFCARD_CONTROL, CRT571_PM_RFCARD_CONTROL_POWER_DOWN, nil)
+	return err
+}
+
+// Mifare read/write operation, data is sub-command and its parameters as device expects
+func (card *CRT571MifareCard) ReadWrite(data []byte) ([]byte, error) {
+	return card.ReadWriteContext(card.background(), data)
+}
+
+// Mifare read/write operation with context
+func (card *CRT571MifareCard) ReadWriteContext(ctx context.Context, data []byte) ([]byte, error) {
+	return card.command(ctx, CRT571_CM_RFCARD_CONTROL, CRT571_PM_RFCARD_CONTROL_CARD_RW, data)
+}
+
+// Type A or Type B T=CL contactless CPU card
+type CRT571TCLCard struct {
+	cardHandle
+}
+
+// Activate RF card, returns card data (ATS/ATQB)
+func (card *CRT571TCLCard) Activate() ([]byte, error) {
+	return card.ActivateContext(card.background())
+}
+
+// Activate RF card with context
+func (card *CRT571TCLCard) ActivateContext(ctx context.Context) ([]byte, error) {
+	return card.command(ctx, CRT571_CM_RFCARD_CONTROL, CRT571_PM_RFCARD_CONTROL_STARTUP, nil)
+}
+
+// Power down RF card
+func (card *CRT571TCLCard) Close() error {
+	return card.CloseContext(card.background())
+}
+
+// Power down RF card with context
+func (card *CRT571TCLCard) CloseContext(ctx context.Context) error {
+	_, err := card.command(ctx, CRT571_CM_RFCARD_CONTROL, CRT571_PM_RFCARD_CONTROL_POWER_DOWN, nil)
+	return err
+}
+
+// Exchange APDU, returns response APDU
+func (card *CRT571TCLCard) Transmit(apdu []byte) ([]byte, error) {
+	return card.TransmitContext(card.background(), apdu)
+}
+
+// Exchange APDU with context
+func (card *CRT571TCLCard) TransmitContext(ctx context.Context, apdu []byte) ([]byte, error) {
+	pm := CRT571_PM_RFCARD_CONTROL_TYPEA_APDU
+	if card.kind == CRT571_CARD_KIND_TYPE_B_TCL {
+		pm = CRT571_PM_RFCARD_CONTROL_TYPEB_APDU
+	}
+	return card.command(ctx, CRT571_CM_RFCARD_CONTROL, pm, apdu)
+}
+
+// Exchange command APDU, GET RESPONSE on 61xx and Le correction on 6Cxx
+// are handled, data of chained responses is concatenated
+func (card *CRT571TCLCard) TransmitAPDU(cmd CRT571CommandAPDU) (*CRT571ResponseAPDU, error) {
+	return card.TransmitAPDUContext(card.background(), cmd)
+}
+
+// Exchange command APDU with context
+func (card *CRT571TCLCard) TransmitAPDUContext(ctx context.Context, cmd CRT571CommandAPDU) (*CRT571ResponseAPDU, error) {
+	return transmitAPDU(func(apdu []byte) ([]byte, error) { return card.TransmitContext(ctx, apdu) }, cmd)
+}
+
+// Card of unknown kind, no operations
+type CRT571UnknownCard struct {
+	cardHandle
+}
@@ -0,0 +1,178 @@
+package crt571_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/syntech-pro/crt571"
+	"github.com/syntech-pro/crt571/simulator"
+)
+
+func TestDetectCard(t *testing.T) {
+	service, _ := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true, CardICType: "20"})
+	if _, err := service.MoveTo(crt571.CRT571_POSITION_IC); err != nil {
+		t.Fatal(err)
+	}
+
+	card, err := service.DetectCard()
+	if err != nil {
+		t.Fatalf("DetectCard() error: %v", err)
+	}
+	if _, ok := card.(*crt571.CRT571SLE4442); !ok || card.Kind() != crt571.CRT571_CARD_KIND_SLE4442 {
+		t.Errorf("DetectCard() = %T %s, want SLE4442 card", card, card.Kind())
+	}
+}
+
+func TestDetectCardNoChip(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true})
+	if _, err := service.MoveTo(crt571.CRT571_POSITION_IC); err != nil {
+		t.Fatal(err)
+	}
+	dev.Fail(crt571.CRT571_CM_CARD_TYPE, "61")
+
+	card, err := service.DetectCard()
+	if err != nil {
+		t.Fatalf("DetectCard() error: %v", err)
+	}
+	if _, ok := card.(*crt571.CRT571UnknownCard); !ok {
+		t.Errorf("DetectCard() = %T %s, want unknown card", card, card.Kind())
+	}
+}
+
+func TestDetectCardDeviceError(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		initialized bool
+		fail        string
+		err         error
+	}{
+		{"not reset", false, "", crt571.ErrNotReset},
+		{"no card", true, "", crt571.ErrCommandSequence},
+		{"card jam", true, "10", crt571.ErrCardJam},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: tc.initialized})
+			if tc.fail != "" {
+				dev.Fail(crt571.CRT571_CM_CARD_TYPE, tc.fail)
+			}
+
+			card, err := service.DetectCard()
+			if !errors.Is(err, tc.err) || card != nil {
+				t.Errorf("DetectCard() = %v, %v, want %v", card, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestCardContext(t *testing.T) {
+	service, _ := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true})
+	if _, err := service.MoveTo(crt571.CRT571_POSITION_IC); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(crt571.WithPriority(context.Background(), crt571.CRT571_PRIORITY_HIGH), 5*time.Second)
+	card, err := service.DetectCardContext(ctx)
+	if err != nil {
+		t.Fatalf("DetectCardContext() error: %v", err)
+	}
+	cpu, ok := card.(*crt571.CRT571CPUCard)
+	if !ok {
+		t.Fatalf("DetectCardContext() = %T, want CPU card", card)
+	}
+	sam, err := service.SAMContext(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Detection ctx does not limit later operations
+	cancel()
+	if _, err = cpu.ColdReset(); err != nil {
+		t.Fatalf("ColdReset() after detection ctx is done error: %v", err)
+	}
+	if _, err = sam.ColdReset(); err != nil {
+		t.Fatalf("SAM ColdReset() after handle ctx is done error: %v", err)
+	}
+
+	// Operation ctx does
+	if _, err = cpu.TransmitContext(ctx, []byte{0x00, 0xa4, 0x04, 0x00}); !errors.Is(err, context.Canceled) {
+		t.Errorf("TransmitContext() with cancelled context error: %v, want context.Canceled", err)
+	}
+	if _, err = sam.TransmitAPDUContext(ctx, crt571.CRT571CommandAPDU{INS: 0xa4, P1: 0x04}); !errors.Is(err, context.Canceled) {
+		t.Errorf("SAM TransmitAPDUContext() with cancelled context error: %v, want context.Canceled", err)
+	}
+	if _, err = cpu.TransmitAPDU(crt571.CRT571CommandAPDU{INS: 0xa4, P1: 0x04, Data: []byte{0xa0, 0x00}}); err != nil {
+		t.Errorf("TransmitAPDU() error: %v", err)
+	}
+}
+
+func TestDispensePersonalizeCard(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil && !dev.TakeCard() {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	personalize := func(ctx context.Context, service *crt571.CRT571Service) error {
+		card, err := service.DetectCardContext(ctx)
+		if err != nil {
+			return err
+		}
+		cpu, ok := card.(*crt571.CRT571CPUCard)
+		if !ok {
+			return fmt.Errorf("unexpected card %T", card)
+		}
+		if _, err = cpu.ColdReset(); err != nil {
+			return err
+		}
+		res, err := cpu.TransmitAPDU(crt571.CRT571CommandAPDU{INS: 0xa4, P1: 0x04, Data: []byte{0xa0, 0x00}})
+		if err != nil {
+			return err
+		}
+		if !res.OK() {
+			return fmt.Errorf("SELECT %s", res)
+		}
+		return cpu.Close()
+	}
+	outcome, err := service.Dispense(ctx, crt571.CRT571DispenseSteps{Personalize: personalize, PollInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dispense() error: %v, outcome %s", err, outcome)
+	}
+	if !outcome.Taken {
+		t.Errorf("outcome %s, want card taken", outcome)
+	}
+}
+
+func TestDetectIICCard(t *testing.T) {
+	for code, size := range map[string]int{"30": 128, "31": 256, "34": 2048, "38": 32768} {
+		t.Run(code, func(t *testing.T) {
+			service, _ := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true, CardICType: code})
+			if _, err := service.MoveTo(crt571.CRT571_POSITION_IC); err != nil {
+				t.Fatal(err)
+			}
+
+			card, err := service.DetectCard()
+			if err != nil {
+				t.Fatalf("DetectCard() error: %v", err)
+			}
+			iic, ok := card.(*crt571.CRT571IICCard)
+			if !ok || card.Kind() != crt571.CRT571_CARD_KIND_24CXX {
+				t.Fatalf("DetectCard() = %T %s, want 24Cxx card", card, card.Kind())
+			}
+			if iic.Size() != size {
+				t.Errorf("Size() = %d, want %d", iic.Size(), size)
+			}
+			if _, err = iic.Read(uint16(size-8), 16); !errors.Is(err, crt571.ErrCardAddress) {
+				t.Errorf("Read() beyond card size error: %v, want ErrCardAddress", err)
+			}
+			if err = iic.Write(uint16(size-1), []byte{1, 2}); !errors.Is(err, crt571.ErrCardAddress) {
+				t.Errorf("Write() beyond card size error: %v, want ErrCardAddress", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package crt571
+
+import (
+	"context"
+	"fmt"
+)
+
+// Contact CPU card (T=0 or T=1) session. Reset card with ColdReset before
+// Transmit, Close powers card down.
+type CRT571CPUCard struct {
+	cardHandle
+	atr *CRT571ATR
+}
+
+// Cold reset (activate) card, returns answer to reset
+func (card *CRT571CPUCard) ColdReset() (*CRT571ATR, error) {
+	return card.ColdResetContext(card.background())
+}
+
+// Cold reset card with context
+func (card *CRT571CPUCard) ColdResetContext(ctx context.Context) (*CRT571ATR, error) {
+	return card.reset(ctx, CRT571_PM_CPUCARD_CONTROL_COLD_RESET)
+}
+
+// Warm (hot) reset of activated card, returns answer to reset
+func (card *CRT571CPUCard) WarmReset() (*CRT571ATR, error) {
+	return card.WarmResetContext(card.background())
+}
+
+// Warm reset card with context
+func (card *CRT571CPUCard) WarmResetContext(ctx context.Context) (*CRT571ATR, error) {
+	return card.reset(ctx, CRT571_PM_CPUCARD_CONTROL_HOT_RESET)
+}
+
+func (card *CRT571CPUCard) reset(ctx context.Context, pm byte) (*CRT571ATR, error) {
+	card.atr = nil
+	data, err := card.command(ctx, CRT571_CM_CPUCARD_CONTROL, pm, nil)
+	if err != nil {
+		return nil, err
+	}
+	atr, err := parseResetATR(data)
+	if err != nil {
+		return nil, err
+	}
+	card.service.log.Debug("CPUCard: reset", "atr", atr)
+	card.atr = atr
+	return atr, nil
+}
+
+// Answer to reset of last reset, nil before reset
+func (card *CRT571CPUCard) ATR() *CRT571ATR {
+	return card.atr
+}
+
+// CPU card status check
+func (card *CRT571CPUCard) Status() ([]byte, error) {
+	return card.StatusContext(card.background())
+}
+
+// CPU card status check with context
+func (card *CRT571CPUCard) StatusContext(ctx context.Context) ([]byte, error) {
+	return card.command(ctx, CRT571_CM_CPUCARD_CONTROL, CRT571_PM_CPUCARD_CONTROL_STATUS_CHECK, nil)
+}
+
+// Exchange APDU, returns response APDU. APDU exchange PM is chosen by
+// protocol of ATR: T=0, T=1 or auto distinguish if card was not reset.
+func (card *CRT571CPUCard) Transmit(apdu []byte) ([]byte, error) {
+	return card.TransmitContext(card.background(), apdu)
+}
+
+// Exchange APDU with context
+func (card *CRT571CPUCard) TransmitContext(ctx context.Context, apdu []byte) ([]byte, error) {
+	if len(apdu) == 0 {
+		return nil, fmt.Errorf("%w: empty APDU", ErrAPDU)
+	}
+	return card.command(ctx, CRT571_CM_CPUCARD_CONTROL, card.apduPM(), apdu)
+}
+
+func (card *CRT571CPUCard) apduPM() byte {
+	if card.atr == nil {
+		return CRT571_PM_CPUCARD_CONTROL_AUTO_APDU
+	}
+	switch card.atr.Protocol() {
+	case 0:
+		return CRT571_PM_CPUCARD_CONTROL_TO_APDU
+	case 1:
+		return CRT571_PM_CPUCARD_CONTROL_T1_APDU
+	}
+	return CRT571_PM_CPUCARD_CONTROL_AUTO_APDU
+}
+
+// Power down CPU card
+func (card *CRT571CPUCard) Close() error {
+	return card.CloseContext(card.background())
+}
+
+// Power down CPU card with context
+func (card *CRT571CPUCard) CloseContext(ctx context.Context) error {
+	card.atr = nil
+	_, err := card.command(ctx, CRT571_CM_CPUCARD_CONTROL, CRT571_PM_CPUCARD_CONTROL_POWER_DOWN, nil)
+	return err
+}
+
+// Exchange command APDU, GET RESPONSE on 61xx and Le correction on 6Cxx
+// are handled, data of chained responses is concatenated
+func (card *CRT571CPUCard) TransmitAPDU(cmd CRT571CommandAPDU) (*CRT571ResponseAPDU, error) {
+	return card.TransmitAPDUContext(card.background(), cmd)
+}
+
+// Exchange command APDU with context
+func (card *CRT571CPUCard) TransmitAPDUContext(ctx context.Context, cmd CRT571CommandAPDU) (*CRT571ResponseAPDU, error) {
+	return transmitAPDU(func(apdu []byte) ([]byte, error) { return card.TransmitContext(ctx, apdu) }, cmd)
+}
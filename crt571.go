@@ -2,20 +2,21 @@ package crt571
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"time"
-
-	rs232 "github.com/syntech-pro/go-rs232"
-	//rs232 "../go-rs232"
 )
 
 const (
 	CRT571_BUFFER_MAX_LENGTH = 1024
 
+	CRT571_DEFAULT_READ_TIMEOUT    = 100             // Read timeout in Millisecond if not set in config
+	CRT571_DEFAULT_COMMAND_TIMEOUT = 5 * time.Second // Command timeout if not set in CRT571CommandTimeouts
+	CRT571_DEFAULT_RETRIES         = 3               // Retransmissions on NAK or BCC error if not set in config
+
 	// Transpost constants
 	CRT571_STX  byte = 0xf2
 	CRT571_ETX  byte = 0x03
@@ -138,6 +139,31 @@ const (
 	CRT571_PM_RECYCLEBIN_COUNTER_INITIATE byte = 0x31 // Initiate card error card bin counter
 )
 
+var (
+	// Service was not connected to device (open port failed)
+	ErrNotConnected = errors.New("crt571: service is not connected to device")
+	// Device answered neither ACK nor NAK to command
+	ErrNoACK = errors.New("crt571: ACK is absent")
+	// Device answered NAK to every command retransmission
+	ErrRetriesExceeded = errors.New("crt571: command rejected with NAK, retries exceeded")
+	// Response BCC check failed, errors.Is matches any *CRT571ChecksumError
+	ErrChecksum = errors.New("crt571: BCC response check fail")
+)
+
+// Response BCC check failed after all retransmissions
+type CRT571ChecksumError struct {
+	BCC        byte // Received BCC
+	Calculated byte // BCC calculated from received frame
+}
+
+func (e *CRT571ChecksumError) Error() string {
+	return fmt.Sprintf("%s: bcc %02x, calculated %02x", ErrChecksum, e.BCC, e.Calculated)
+}
+
+func (e *CRT571ChecksumError) Is(target error) bool {
+	return target == ErrChecksum
+}
+
 var CRT571Commands = map[byte]string{
 	CRT571_CM_INITIALIZE:                "Initialize CRT-571",
 	CRT571_CM_STATUS_REQUEST:            "Inquire status",
@@ -289,17 +315,47 @@ var CRT571Errors = map[string]string{
 	"B0": "Not Reset",
 }
 
+// Default command timeouts (from command write to response).
+// Can be overridden with CRT571Config.CommandTimeouts
+var CRT571CommandTimeouts = map[byte]time.Duration{
+	CRT571_CM_INITIALIZE:                30 * time.Second,
+	CRT571_CM_STATUS_REQUEST:            2 * time.Second,
+	CRT571_CM_CARD_MOVE:                 20 * time.Second,
+	CRT571_CM_CARD_ENTRY:                5 * time.Second,
+	CRT571_CM_CARD_TYPE:                 5 * time.Second,
+	CRT571_CM_CPUCARD_CONTROL:           10 * time.Second,
+	CRT571_CM_SAM_CARD_CONTROL:          10 * time.Second,
+	CRT571_CM_SLE4442_4428_CARD_CONTROL: 5 * time.Second,
+	CRT571_CM_IIC_MEMORYCARD:            5 * time.Second,
+	CRT571_CM_RFCARD_CONTROL:            10 * time.Second,
+	CRT571_CM_CARD_SERIAL_NUMBER:        2 * time.Second,
+	CRT571_CM_READ_CARD_CONFIG:          2 * time.Second,
+	CRT571_CM_READ_CRT571_VERSION:       2 * time.Second,
+	CRT571_CM_RECYCLEBIN_COUNTER:        2 * time.Second,
+}
+
+// CRT571Service is safe for concurrent use, commands are sent to device
+// one by one from queue (see CRT571Priority).
 type CRT571Service struct {
-	config  CRT571Config
-	port    *rs232.SerialPort
-	address byte
+	config    CRT571Config
+	transport CRT571Transport
+	address   byte
+	log       CRT571Logger
+	queue     *commandQueue
+	tracker   *positionTracker
+	sam       *samState
 }
 
 type CRT571Config struct {
 	BaudRate    int
 	Path        string
 	Address     int
-	ReadTimeout int // Read timeout in Millisecond
+	ReadTimeout int          // Inter-byte read timeout in Millisecond
+	Logger      CRT571Logger // Logger, e.g. *slog.Logger. Silent if nil
+
+	CommandTimeouts map[byte]time.Duration // Command timeouts by CM, override CRT571CommandTimeouts
+	Retries         int                    // Retransmissions on NAK or BCC error. CRT571_DEFAULT_RETRIES if 0, none if negative
+	LenientBCC      bool                   // Accept responses with wrong BCC without retransmission (diagnostics of flaky cables)
 }
 
 type CRT571Response struct {
@@ -318,116 +374,235 @@ func (response *CRT571Response) String() string {
 	switch response.Type {
 	case CRT571_PMT: // Positve response
 		return fmt.Sprintf("CRT-571 positive response: card status:['%s','%s','%s'], data:[%s]", response.ST0Message, response.ST1Message, response.ST2Message, response.Data)
-	case CRT571_EMT: // Failed response
-		return fmt.Sprintf("CRT-571 error response: %s(%s), data:[%s]", response.ErrorMessage, response.ErrorCode, response.Data)
+	case CRT571_EMT, CRT571_EMT2: // Failed response
+		return fmt.Sprintf("CRT-571 error response: %s(%s, %s), data:[%s]", response.ErrorMessage, response.Code(), response.ErrorClass(), response.Data)
 	}
 	return "Unexpected response type"
 }
 
-// Init CRT571
-func InitCRT571Service(config CRT571Config) (service CRT571Service, err error) {
+// Decoded error code of failed response, "" for positive response
+func (response *CRT571Response) Code() CRT571ErrorCode {
+	if len(response.ErrorCode) != 2 {
+		return ""
+	}
+	return DecodeErrorCode(response.ErrorCode[0], response.ErrorCode[1])
+}
 
-	service = CRT571Service{config: config}
+// Error class of failed response
+func (response *CRT571Response) ErrorClass() CRT571ErrorClass {
+	return response.Code().Class()
+}
 
-	// Init reader goroutine and channels
-	//service.chReq = make(chan CRT571Exchange, CRT571_SERVICE_QUEUE_SIZE)
+// Init CRT571 on serial port config.Path
+func InitCRT571Service(config CRT571Config) (service CRT571Service, err error) {
 
-	service.port, err = rs232.OpenPort(config.Path, config.BaudRate, rs232.S_8N1X)
+	transport, err := OpenSerialTransport(config.Path, config.BaudRate)
 	if err != nil {
-		log.Fatalf("[ERROR] Error opening port %q: %s", config.Path, err)
+		loggerOf(config).Error("InitCRT571Service(): open port error", "path", config.Path, "error", err)
+		return CRT571Service{config: config, log: loggerOf(config)}, fmt.Errorf("crt571: open port %q: %w", config.Path, err)
+	}
+
+	return InitCRT571ServiceWithTransport(config, transport)
+}
+
+// Init CRT571 on any transport (serial port, TCP connection, pipe, fake device).
+// config.Path and config.BaudRate are ignored.
+func InitCRT571ServiceWithTransport(config CRT571Config, transport CRT571Transport) (service CRT571Service, err error) {
+
+	service = CRT571Service{config: config, transport: transport, log: loggerOf(config)}
+	if transport == nil {
+		return service, ErrNotConnected
+	}
+
+	if service.config.ReadTimeout <= 0 {
+		service.config.ReadTimeout = CRT571_DEFAULT_READ_TIMEOUT
 	}
 
 	service.address = byte(config.Address)
-	service.port.SetInputAttr(0, time.Duration(config.ReadTimeout)*time.Millisecond)
+	err = service.transport.SetReadTimeout(time.Duration(service.config.ReadTimeout) * time.Millisecond)
+	if err != nil {
+		return
+	}
+
+	// Start command queue worker
+	service.tracker = &positionTracker{}
+	service.sam = &samState{}
+	service.queue = newCommandQueue()
+	worker := service
+	go service.queue.serve(worker.command)
 
 	return
 }
 
-func (service *CRT571Service) read(buf []byte) (int, error) {
-	i := 0
-	for {
-		len, err := service.port.Read(buf[i:])
-		if err != nil {
-			if err == io.EOF {
-				log.Printf("[INFO] read(): Read EOF data:[% x] len:%v", buf[i:i+len], len)
-				break
-			}
-			log.Printf("[ERROR] read(): Read error:%s", err)
-			return 0, err
-		}
-		//		log.Printf("[INFO] read(): Read data:[% x] len:%v", buf[i:i+len], len)
-		log.Printf("[INFO] read(): Read buffer:[% x] len:%v", buf[i:i+len], len)
-		i += len
+// Stop command queue and close transport
+func (service *CRT571Service) Close() error {
+	if service.transport == nil {
+		return ErrNotConnected
 	}
-	return i, nil
+	if service.queue != nil {
+		service.queue.close()
+	}
+	return service.transport.Close()
 }
 
-// Exchange with CRT-571
-func (service *CRT571Service) exchange(data []byte) ([]byte, error) {
-	buf := make([]byte, CRT571_BUFFER_MAX_LENGTH)
-
-	log.Printf("[INFO] exchange(): Write data:[% x] len: %v", data, len(data))
+// Exchange with CRT-571. Command is retransmitted when device answers NAK,
+// response is requested again with NAK when its BCC fails. Line is cleared
+// with EOT if exchange is aborted.
+func (service *CRT571Service) exchange(ctx context.Context, data []byte) (res []byte, err error) {
+	var decoder frameDecoder
 
-	// write to device
-	len, err := service.port.Write(data)
-	if err != nil {
-		log.Printf("[ERROR] exchange(): Write error:%s", err)
-		return nil, err
+	if service.transport == nil {
+		return nil, ErrNotConnected
 	}
-	log.Printf("[INFO] exchange(): Wrote len: %v", len)
-	// TODO check size of write data
 
-	// read ACK response
-	len, err = service.read(buf)
-	if err != nil {
-		log.Printf("[ERROR] exchange(): Read ACK  error:%s", err)
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	log.Printf("[INFO] exchange(): Read ACK data:[% x]", buf[:len])
-	if buf[0] != CRT571_ACK {
-		log.Print("[ERROR] exchange(): ACK is absent")
-		return nil, errors.New("ACK is absent")
-		// TODO send NAK
+
+	defer func() {
+		if err != nil {
+			service.clearLine()
+		}
+	}()
+
+	retries := service.retries()
+
+	// write command to device until ACK
+	for attempt := 0; ; attempt++ {
+		service.log.Debug("exchange(): write data", "data", hexBytes(data), "len", len(data), "attempt", attempt)
+
+		if err := service.write(data); err != nil {
+			service.log.Error("exchange(): write error", "error", err)
+			return nil, err
+		}
+		service.log.Debug("exchange(): wrote data", "len", len(data))
+
+		// read ACK response
+		kind, frame, err := service.readFrame(ctx, &decoder)
+		if err != nil {
+			service.log.Error("exchange(): read ACK error", "error", err)
+			return nil, err
+		}
+
+		if kind == frameACK {
+			service.log.Debug("exchange(): read ACK")
+			break
+		}
+		if kind != frameNAK {
+			service.log.Error("exchange(): ACK is absent", "data", hexBytes(frame))
+			return nil, ErrNoACK
+		}
+		service.log.Warn("exchange(): NAK received", "attempt", attempt)
+		if attempt >= retries {
+			return nil, ErrRetriesExceeded
+		}
 	}
 
 	// read command response
-	if len > 1 {
-		buf = buf[1:]
-		len -= 1
-	} else {
-		len, err = service.read(buf)
+	for attempt := 0; ; attempt++ {
+		kind, frame, err := service.readFrame(ctx, &decoder)
 		if err != nil {
-			log.Printf("[ERROR] exchange(): Read response error:%s", err)
+			service.log.Error("exchange(): read response error", "error", err)
+			return nil, err
+		}
+		if kind != frameData {
+			service.log.Warn("exchange(): unexpected control byte instead of response", "kind", kind)
+			attempt--
+			continue
+		}
+		service.log.Debug("exchange(): read response", "data", hexBytes(frame), "len", len(frame))
+
+		// check bcc
+		n := len(frame)
+		if n > 1 && bccCheck(frame[n-1], frame[:n-1]) {
+			res = frame
+			break
+		}
+		checksumErr := &CRT571ChecksumError{BCC: frame[n-1], Calculated: bccCalc(frame[:n-1])}
+		service.log.Warn("exchange(): BCC response check fail", "bcc", hexByte(checksumErr.BCC), "calculated", hexByte(checksumErr.Calculated), "attempt", attempt)
+		if service.config.LenientBCC {
+			res = frame
+			break
+		}
+		if attempt >= retries {
+			service.log.Error("exchange(): BCC response check fail, retries exceeded", "retries", retries)
+			return nil, checksumErr
+		}
+
+		// ask device to retransmit response
+		if err = service.write([]byte{CRT571_NAK}); err != nil {
+			service.log.Error("exchange(): write NAK error", "error", err)
 			return nil, err
 		}
-	}
-	log.Printf("[INFO] exchange(): Read response data:[% x] len:%v", buf[:len], len)
-
-	// check bcc
-	if !bccCheck(buf[len-1], buf[:len-1]) {
-		log.Print("[ERROR] exchange(): BCC response check fail!")
-		//return nil, errors.New("BCC response check fail!")
-	} else {
-		log.Print("[INFO] exchange(): BCC response check success")
 	}
 
 	// write ACK to device
-	len, err = service.port.Write([]byte{CRT571_ACK})
-	if err != nil {
-		log.Printf("[ERROR] exchange(): Write ACK error:%s", err)
+	if err = service.write([]byte{CRT571_ACK}); err != nil {
+		service.log.Error("exchange(): write ACK error", "error", err)
 		return nil, err
 	}
-	log.Printf("[INFO] exchange(): Wrote ACK len: %v", len)
+	service.log.Debug("exchange(): wrote ACK")
 
-	return buf, nil
+	return res, nil
+}
 
+// Write all data, serial port may accept only part of it
+func (service *CRT571Service) write(data []byte) error {
+	for len(data) > 0 {
+		n, err := service.transport.Write(data)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return io.ErrShortWrite
+		}
+		data = data[n:]
+	}
+	return nil
 }
 
-// Make request to CRT571
-func (service *CRT571Service) request(cm, pm byte, data []byte) (*CRT571Response, error) {
-	var response CRT571Response
+// Clear the line after aborted exchange: write EOT and discard input until
+// line is idle for ReadTimeout, so late response of aborted command is not
+// taken as answer to next command
+func (service *CRT571Service) clearLine() {
+	if err := service.write([]byte{CRT571_EOT}); err != nil {
+		service.log.Error("clearLine(): write EOT error", "error", err)
+		return
+	}
+	service.log.Debug("clearLine(): wrote EOT")
+
+	buf := make([]byte, CRT571_BUFFER_MAX_LENGTH)
+	deadline := time.Now().Add(CRT571_DEFAULT_COMMAND_TIMEOUT)
+	for time.Now().Before(deadline) {
+		n, err := service.transport.Read(buf)
+		if n > 0 {
+			service.log.Debug("clearLine(): discarded input", "data", hexBytes(buf[:n]), "len", n)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			service.log.Error("clearLine(): read error", "error", err)
+		}
+		if err != nil {
+			return
+		}
+	}
+	service.log.Warn("clearLine(): line is not idle")
+}
 
-	log.Printf("[INFO] request(): Call with CM:%x, PM:%x, Data:[%x]", cm, pm, data)
+// Retransmission count
+func (service *CRT571Service) retries() int {
+	if service.config.Retries == 0 {
+		return CRT571_DEFAULT_RETRIES
+	}
+	if service.config.Retries < 0 {
+		return 0
+	}
+	return service.config.Retries
+}
+
+// Make request to CRT571
+func (service *CRT571Service) request(ctx context.Context, cm, pm byte, data []byte) (*CRT571Response, error) {
+	service.log.Debug("request(): call", "cm", hexByte(cm), "pm", hexByte(pm), "data", hexBytes(data))
 
 	var b bytes.Buffer
 
@@ -448,56 +623,81 @@ func (service *CRT571Service) request(cm, pm byte, data []byte) (*CRT571Response
 	bcc := bccCalc(b.Bytes())
 	b.WriteByte(bcc)
 
-	log.Printf("[INFO] request(): buffer:[% x]", b.Bytes())
+	service.log.Debug("request(): buffer", "data", hexBytes(b.Bytes()))
 
 	if b.Len() > CRT571_BUFFER_MAX_LENGTH {
 		return nil, errors.New("[ERROR] Exceed max packet size for CRT-571")
 	}
 
-	buf, err := service.exchange(b.Bytes())
+	buf, err := service.exchange(ctx, b.Bytes())
 	if err != nil {
 		return nil, err
 	}
 
-	datalen := int(binary.BigEndian.Uint16(buf[2:4]))
-	response.DataLen = datalen
-	response.Type = buf[4]
-
-	switch response.Type {
-	case CRT571_PMT: // Positve response
-		response.CardStatus = buf[7:10]
-		response.ST0Message = CRT571CardStatus["ST0"][buf[7]]
-		response.ST1Message = CRT571CardStatus["ST1"][buf[8]]
-		response.ST2Message = CRT571CardStatus["ST2"][buf[9]]
-		response.Data = buf[10 : 10+datalen-6]
-		log.Printf("[INFO] request(): Get positive response. Card status:[% x]=[%s;%s;%s] data:[% x]=[%[5]s]", response.CardStatus, response.ST0Message, response.ST1Message, response.ST2Message, response.Data)
-
-		return &response, nil
+	response, err := parseResponse(buf, service.address, cm, pm)
+	if err != nil {
+		service.log.Error("request(): bad response", "cm", hexByte(cm), "pm", hexByte(pm), "error", err)
+		return nil, err
+	}
 
-	case CRT571_EMT, CRT571_EMT2: // Failed response
-		response.Data = buf[9 : 9+datalen-5]
-		response.ErrorCode = buf[6:8]
-		response.ErrorMessage = CRT571Errors[string(buf[6:8])]
-		log.Printf("[ERROR] request(): Get negative response. Card status:[% x] data:[% x]=[%[2]s]", response.ErrorCode, response.Data)
-		return &response, errors.New(response.ErrorMessage)
+	if response.Type == CRT571_PMT { // Positve response
+		service.log.Debug("request(): positive response", "cm", hexByte(cm), "pm", hexByte(pm), "status", hexBytes(response.CardStatus), "data", hexBytes(response.Data))
+		return response, nil
 	}
 
-	return &response, errors.New(fmt.Sprintf("[ERROR] Unknow data response status [%x]", response.Type))
+	// Failed response
+	service.log.Debug("request(): negative response", "cm", hexByte(cm), "pm", hexByte(pm), "code", response.Code(), "class", response.ErrorClass(), "data", hexBytes(response.Data))
+	return response, newDeviceError(cm, pm, response)
 }
 
 // Command request
 func (service *CRT571Service) Command(command, pm byte, data []byte) (*CRT571Response, error) {
-	log.Printf("[INFO] Command:[%s] PM:[%x]", CRT571Commands[command], pm)
+	return service.CommandContext(context.Background(), command, pm, data)
+}
+
+// Command request with context. Command is limited with its timeout
+// (CRT571Config.CommandTimeouts, CRT571CommandTimeouts) and ctx deadline.
+// Command waits in queue with priority set by WithPriority(ctx, ...).
+func (service *CRT571Service) CommandContext(ctx context.Context, command, pm byte, data []byte) (*CRT571Response, error) {
+	if service.queue == nil {
+		return nil, ErrNotConnected
+	}
+	return service.queue.submit(ctx, command, pm, data)
+}
 
-	res, err := service.request(command, pm, data)
+// Execute command, called by queue worker
+func (service *CRT571Service) command(ctx context.Context, command, pm byte, data []byte) (*CRT571Response, error) {
+	service.log.Debug("Command(): call", "command", CRT571Commands[command], "cm", hexByte(command), "pm", hexByte(pm))
+
+	ctx, cancel := context.WithTimeout(ctx, service.commandTimeout(command))
+	defer cancel()
+
+	res, err := service.request(ctx, command, pm, data)
+	service.sam.update(command, pm, data, err)
 	if err != nil {
-		log.Printf("[ERROR] Command:[%s] PM:[%s] Error:[%v]", CRT571Commands[command], CRT571PMInfo[command][pm], err)
+		if res != nil && res.ErrorCode != nil {
+			service.log.Error("Command(): device error", "command", CRT571Commands[command], "cm", hexByte(command), "pm", hexByte(pm), "code", res.Code(), "class", res.ErrorClass(), "error", err)
+		} else {
+			service.log.Error("Command(): error", "command", CRT571Commands[command], "cm", hexByte(command), "pm", hexByte(pm), "error", err)
+		}
 		return res, err
 	}
-	log.Printf("[INFO] Command:[%s]: PM:[%s] Card status:[% x] data:[%s]", CRT571Commands[command], CRT571PMInfo[command][pm], res.CardStatus, res.Data)
+	service.tracker.update(command, pm, res.DeviceStatus())
+	service.log.Debug("Command(): done", "command", CRT571Commands[command], "cm", hexByte(command), "pm", hexByte(pm), "status", hexBytes(res.CardStatus))
 	return res, nil
 }
 
+// Timeout of command cm
+func (service *CRT571Service) commandTimeout(cm byte) time.Duration {
+	if timeout, ok := service.config.CommandTimeouts[cm]; ok {
+		return timeout
+	}
+	if timeout, ok := CRT571CommandTimeouts[cm]; ok {
+		return timeout
+	}
+	return CRT571_DEFAULT_COMMAND_TIMEOUT
+}
+
 func bccCalc(a []byte) byte {
 	bcc := byte(0)
 	n := len(a)
@@ -509,11 +709,5 @@ func bccCalc(a []byte) byte {
 }
 
 func bccCheck(bcc byte, data []byte) bool {
-	bcc2 := bccCalc(data)
-	log.Printf("[INFO] bccCalculate(): data:[% x] bcc:[%x] bcc calculated:[%x]", data, bcc, bcc2)
-
-	if bcc == bcc2 {
-		return true
-	}
-	return false
+	return bcc == bccCalc(data)
 }
@@ -0,0 +1,306 @@
+package crt571_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/syntech-pro/crt571"
+	"github.com/syntech-pro/crt571/simulator"
+)
+
+// Service connected to simulated device
+func newSimulatorService(t *testing.T, config crt571.CRT571Config, simConfig simulator.Config) (*crt571.CRT571Service, *simulator.Device) {
+	t.Helper()
+	if config.ReadTimeout == 0 {
+		config.ReadTimeout = 10
+	}
+	dev := simulator.New(simConfig)
+	service, err := crt571.InitCRT571ServiceWithTransport(config, dev.Transport())
+	if err != nil {
+		t.Fatalf("InitCRT571ServiceWithTransport() error: %v", err)
+	}
+	t.Cleanup(func() { service.Close() })
+	return &service, dev
+}
+
+// Transport recording bytes written to device
+type recordingTransport struct {
+	crt571.CRT571Transport
+	mu      sync.Mutex
+	written []byte
+}
+
+func (t *recordingTransport) Write(data []byte) (int, error) {
+	t.mu.Lock()
+	t.written = append(t.written, data...)
+	t.mu.Unlock()
+	return t.CRT571Transport.Write(data)
+}
+
+func (t *recordingTransport) Written() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]byte(nil), t.written...)
+}
+
+// Transport accepting at most 3 bytes per Write
+type shortWriteTransport struct {
+	crt571.CRT571Transport
+}
+
+func (t *shortWriteTransport) Write(data []byte) (int, error) {
+	if len(data) > 3 {
+		data = data[:3]
+	}
+	return t.CRT571Transport.Write(data)
+}
+
+func TestSimulatorStatus(t *testing.T) {
+	service, _ := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 5, Initialized: true})
+
+	status, err := service.Status()
+	if err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if status.Card != crt571.CRT571_CARD_NONE || status.Stacker != crt571.CRT571_STACKER_FEW || status.ErrorBin != crt571.CRT571_ERROR_BIN_NOT_FULL {
+		t.Errorf("Status() = %s", status)
+	}
+}
+
+func TestSimulatorCardMove(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true})
+
+	res, err := service.Command(crt571.CRT571_CM_CARD_MOVE, crt571.CRT571_PM_CARD_MOVE_IC_POS, nil)
+	if err != nil {
+		t.Fatalf("Command(CARD_MOVE) error: %v", err)
+	}
+	if res.Type != crt571.CRT571_PMT || res.DeviceStatus().Card != crt571.CRT571_CARD_ON_POSITION {
+		t.Errorf("Command(CARD_MOVE) = %s", res)
+	}
+	if state := dev.State(); state.Position != simulator.PositionIC || state.StackerCards != 49 {
+		t.Errorf("device state %+v, want card on IC position and 49 cards in stacker", state)
+	}
+	if position := service.CurrentPosition(); position != crt571.CRT571_POSITION_IC {
+		t.Errorf("CurrentPosition() = %s", position)
+	}
+}
+
+func TestSimulatorFail(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true})
+	dev.Fail(crt571.CRT571_CM_CARD_MOVE, "10")
+
+	res, err := service.Command(crt571.CRT571_CM_CARD_MOVE, crt571.CRT571_PM_CARD_MOVE_IC_POS, nil)
+	if !errors.Is(err, crt571.ErrCardJam) {
+		t.Fatalf("Command(CARD_MOVE) error: %v, want ErrCardJam", err)
+	}
+	var deviceErr *crt571.CRT571DeviceError
+	if !errors.As(err, &deviceErr) || deviceErr.Code != "10" || deviceErr.Class() != crt571.CRT571_ERROR_OPERATOR_ACTION {
+		t.Errorf("error %v, want *CRT571DeviceError with code 10", err)
+	}
+	if res == nil || res.Code() != "10" {
+		t.Errorf("response %v, want error response with code 10", res)
+	}
+
+	// Failure is consumed
+	if _, err = service.Command(crt571.CRT571_CM_CARD_MOVE, crt571.CRT571_PM_CARD_MOVE_IC_POS, nil); err != nil {
+		t.Errorf("Command(CARD_MOVE) after failure error: %v", err)
+	}
+}
+
+func TestExchangeNAK(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		retries int // CRT571Config.Retries
+		naks    int
+		err     error
+	}{
+		{"default retries", 0, crt571.CRT571_DEFAULT_RETRIES, nil},
+		{"default retries exceeded", 0, crt571.CRT571_DEFAULT_RETRIES + 1, crt571.ErrRetriesExceeded},
+		{"one retry", 1, 1, nil},
+		{"one retry exceeded", 1, 2, crt571.ErrRetriesExceeded},
+		{"no retries", -1, 1, crt571.ErrRetriesExceeded},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			service, dev := newSimulatorService(t, crt571.CRT571Config{Retries: tc.retries}, simulator.Config{Initialized: true})
+			dev.NAKCommands(tc.naks)
+
+			_, err := service.Status()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Status() error: %v, want %v", err, tc.err)
+			}
+			// Link recovers after retries are exceeded
+			if _, err = service.Status(); err != nil {
+				t.Errorf("Status() after NAKs error: %v", err)
+			}
+		})
+	}
+}
+
+func TestExchangeClearLineOnAbort(t *testing.T) {
+	dev := simulator.New(simulator.Config{Initialized: true})
+	transport := &recordingTransport{CRT571Transport: dev.Transport()}
+	service, err := crt571.InitCRT571ServiceWithTransport(crt571.CRT571Config{ReadTimeout: 10, Retries: 1}, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	dev.NAKCommands(2)
+	if _, err = service.Status(); !errors.Is(err, crt571.ErrRetriesExceeded) {
+		t.Fatalf("Status() error: %v, want ErrRetriesExceeded", err)
+	}
+	written := transport.Written()
+	if len(written) == 0 || written[len(written)-1] != crt571.CRT571_EOT {
+		t.Errorf("written [% x], want EOT at the end", written)
+	}
+	if n := bytes.Count(written, []byte{crt571.CRT571_STX}); n != 2 {
+		t.Errorf("command written %d times, want 2", n)
+	}
+
+	// Successful exchange ends with ACK, line is not cleared
+	if _, err = service.Status(); err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	written = transport.Written()
+	if written[len(written)-1] != crt571.CRT571_ACK || bytes.Count(written, []byte{crt571.CRT571_EOT}) != 1 {
+		t.Errorf("written [% x], want ACK at the end and single EOT", written)
+	}
+}
+
+func TestExchangeShortWrite(t *testing.T) {
+	dev := simulator.New(simulator.Config{StackerCards: 50, Initialized: true})
+	service, err := crt571.InitCRT571ServiceWithTransport(crt571.CRT571Config{ReadTimeout: 10}, &shortWriteTransport{dev.Transport()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	if _, err = service.Command(crt571.CRT571_CM_CARD_MOVE, crt571.CRT571_PM_CARD_MOVE_HOLD, nil); err != nil {
+		t.Fatalf("Command(CARD_MOVE) error: %v", err)
+	}
+	if state := dev.State(); state.Position != simulator.PositionHold {
+		t.Errorf("device state %+v, want card on holding position", state)
+	}
+}
+
+func TestExchangeChecksum(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		lenient  bool
+		corrupts int
+		err      error
+	}{
+		{"retransmitted", false, crt571.CRT571_DEFAULT_RETRIES, nil},
+		{"retries exceeded", false, crt571.CRT571_DEFAULT_RETRIES + 1, crt571.ErrChecksum},
+		{"lenient", true, 1, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			service, dev := newSimulatorService(t, crt571.CRT571Config{LenientBCC: tc.lenient}, simulator.Config{StackerCards: 50, Initialized: true})
+			dev.CorruptResponses(tc.corrupts)
+
+			status, err := service.Status()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Status() error: %v, want %v", err, tc.err)
+			}
+			if tc.err != nil {
+				var checksumErr *crt571.CRT571ChecksumError
+				if !errors.As(err, &checksumErr) || checksumErr.BCC == checksumErr.Calculated {
+					t.Errorf("error %v, want *CRT571ChecksumError", err)
+				}
+				return
+			}
+			if status.Card != crt571.CRT571_CARD_NONE || status.Stacker != crt571.CRT571_STACKER_ENOUGH {
+				t.Errorf("Status() = %s", status)
+			}
+		})
+	}
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, ErrorBinCount: 7, Initialized: true})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				switch (i + j) % 3 {
+				case 0:
+					if status, err := service.Status(); err != nil || status.Stacker != crt571.CRT571_STACKER_ENOUGH {
+						t.Errorf("Status() = %s, %v", status, err)
+					}
+				case 1:
+					if sensors, err := service.SensorStatus(); err != nil || sensors.StackerEmpty {
+						t.Errorf("SensorStatus() = %s, %v", sensors, err)
+					}
+				case 2:
+					if count, err := service.ErrorBinCount(); err != nil || count != 7 {
+						t.Errorf("ErrorBinCount() = %d, %v", count, err)
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if state := dev.State(); state.StackerCards != 50 || state.Position != simulator.PositionNone {
+		t.Errorf("device state %+v changed", state)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	timeouts := map[byte]time.Duration{crt571.CRT571_CM_STATUS_REQUEST: 100 * time.Millisecond}
+	service, dev := newSimulatorService(t, crt571.CRT571Config{CommandTimeouts: timeouts}, simulator.Config{Initialized: true})
+	dev.PowerOff()
+
+	for _, tc := range []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		err     error
+		timeout time.Duration
+	}{
+		{"config timeout", func() (context.Context, context.CancelFunc) {
+			return context.WithCancel(context.Background())
+		}, context.DeadlineExceeded, 100 * time.Millisecond},
+		{"ctx deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 50*time.Millisecond)
+		}, context.DeadlineExceeded, 50 * time.Millisecond},
+		{"cancelled during exchange", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled, 50 * time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := tc.ctx()
+			defer cancel()
+
+			start := time.Now()
+			_, err := service.StatusContext(ctx)
+			elapsed := time.Since(start)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("StatusContext() error: %v, want %v", err, tc.err)
+			}
+			// ctx is checked every ReadTimeout (10ms)
+			if elapsed < tc.timeout || elapsed > tc.timeout+500*time.Millisecond {
+				t.Errorf("StatusContext() failed after %s, want %s", elapsed, tc.timeout)
+			}
+		})
+	}
+
+	// Other commands keep default timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := service.CommandContext(ctx, crt571.CRT571_CM_READ_CRT571_VERSION, crt571.CRT571_PM_READ_CRT571_VERSION, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CommandContext() error: %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("CommandContext() failed after %s before ctx deadline", elapsed)
+	}
+}
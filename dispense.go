@@ -0,0 +1,192 @@
+package crt571
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	CRT571_DEFAULT_REMOVAL_TIMEOUT = 30 * time.Second       // Time for customer to take card from gate
+	CRT571_DEFAULT_POLL_INTERVAL   = 500 * time.Millisecond // Status poll interval while waiting for customer
+)
+
+// Customer did not take card from gate in time
+var ErrRemovalTimeout = errors.New("crt571: card was not taken from gate")
+
+// Card is already inside device before dispense
+var ErrCardInside = errors.New("crt571: card is already inside device")
+
+// Dispense workflow stage
+type CRT571DispenseStage int
+
+const (
+	CRT571_DISPENSE_FEED         CRT571DispenseStage = iota // Feed card from stacker to IC/RF position
+	CRT571_DISPENSE_CARD_TYPE                               // Check card type
+	CRT571_DISPENSE_PERSONALIZE                             // Run personalization callback
+	CRT571_DISPENSE_PRESENT                                 // Move card to gate
+	CRT571_DISPENSE_WAIT_REMOVAL                            // Wait for customer to take card
+	CRT571_DISPENSE_DONE                                    // Card was taken
+)
+
+func (stage CRT571DispenseStage) String() string {
+	switch stage {
+	case CRT571_DISPENSE_FEED:
+		return "feed"
+	case CRT571_DISPENSE_CARD_TYPE:
+		return "card type"
+	case CRT571_DISPENSE_PERSONALIZE:
+		return "personalize"
+	case CRT571_DISPENSE_PRESENT:
+		return "present"
+	case CRT571_DISPENSE_WAIT_REMOVAL:
+		return "wait removal"
+	case CRT571_DISPENSE_DONE:
+		return "done"
+	}
+	return "unknown"
+}
+
+type CRT571DispenseSteps struct {
+	Position       CRT571Position                                          // CRT571_POSITION_IC (default) or _RF
+	Personalize    func(ctx context.Context, service *CRT571Service) error // Called with card on Position, optional. Open card with DetectCardContext(ctx)
+	RemovalTimeout time.Duration                                           // CRT571_DEFAULT_REMOVAL_TIMEOUT if 0
+	PollInterval   time.Duration                                           // CRT571_DEFAULT_POLL_INTERVAL if 0
+}
+
+type CRT571DispenseOutcome struct {
+	Stage      CRT571DispenseStage // Failed stage or CRT571_DISPENSE_DONE
+	Taken      bool                // Customer took card
+	Captured   bool                // Card was captured to error card bin after failure
+	Capture    *CRT571CaptureResult
+	CardType   []byte             // Data of CARD_TYPE response
+	Status     CRT571DeviceStatus // Last device status
+	Err        error              // Failure cause
+	CaptureErr error              // Capture failure
+	Duration   time.Duration
+}
+
+func (outcome *CRT571DispenseOutcome) String() string {
+	if outcome.Err == nil {
+		return fmt.Sprintf("card dispensed in %s", outcome.Duration)
+	}
+	return fmt.Sprintf("dispense failed on %s: %s, captured:%t", outcome.Stage, outcome.Err, outcome.Captured)
+}
+
+// Dispense card: feed card from stacker to IC/RF position, run personalization,
+// present card at gate and wait until customer takes it. On failure, timeout or
+// ctx cancellation card is captured to error card bin. Commands are queued
+// with CRT571_PRIORITY_HIGH unless ctx has other priority.
+func (service *CRT571Service) Dispense(ctx context.Context, steps CRT571DispenseSteps) (*CRT571DispenseOutcome, error) {
+	start := time.Now()
+	outcome := &CRT571DispenseOutcome{}
+
+	if steps.Position == CRT571_POSITION_UNKNOWN {
+		steps.Position = CRT571_POSITION_IC
+	}
+	if steps.Position != CRT571_POSITION_IC && steps.Position != CRT571_POSITION_RF {
+		return nil, fmt.Errorf("%w: dispense to %s", ErrIllegalMove, steps.Position)
+	}
+	if steps.RemovalTimeout <= 0 {
+		steps.RemovalTimeout = CRT571_DEFAULT_REMOVAL_TIMEOUT
+	}
+	if steps.PollInterval <= 0 {
+		steps.PollInterval = CRT571_DEFAULT_POLL_INTERVAL
+	}
+	if _, ok := ctx.Value(priorityKey{}).(CRT571Priority); !ok {
+		ctx = WithPriority(ctx, CRT571_PRIORITY_HIGH)
+	}
+
+	err := service.dispense(ctx, steps, outcome)
+	if err != nil {
+		outcome.Err = err
+		service.log.Error("Dispense(): failed", "stage", outcome.Stage, "error", err)
+		// card found inside before dispense is not ours to capture
+		if !errors.Is(err, ErrCardInside) {
+			service.captureAfterFailure(ctx, outcome)
+		}
+	}
+	outcome.Duration = time.Since(start)
+	return outcome, err
+}
+
+func (service *CRT571Service) dispense(ctx context.Context, steps CRT571DispenseSteps, outcome *CRT571DispenseOutcome) (err error) {
+	// Feed
+	outcome.Stage = CRT571_DISPENSE_FEED
+	if outcome.Status, err = service.StatusContext(ctx); err != nil {
+		return err
+	}
+	if outcome.Status.Card != CRT571_CARD_NONE {
+		return ErrCardInside
+	}
+	if outcome.Status, err = service.MoveToContext(ctx, steps.Position); err != nil {
+		return err
+	}
+
+	// Card type
+	outcome.Stage = CRT571_DISPENSE_CARD_TYPE
+	pm := CRT571_PM_CARD_TYPE_IC
+	if steps.Position == CRT571_POSITION_RF {
+		pm = CRT571_PM_CARD_TYPE_RF
+	}
+	res, err := service.CommandContext(ctx, CRT571_CM_CARD_TYPE, pm, nil)
+	if err != nil {
+		return err
+	}
+	outcome.CardType = res.Data
+
+	// Personalize
+	outcome.Stage = CRT571_DISPENSE_PERSONALIZE
+	if steps.Personalize != nil {
+		if err = steps.Personalize(ctx, service); err != nil {
+			return err
+		}
+	}
+
+	// Present
+	outcome.Stage = CRT571_DISPENSE_PRESENT
+	if outcome.Status, err = service.MoveToContext(ctx, CRT571_POSITION_GATE); err != nil {
+		return err
+	}
+
+	// Wait removal
+	outcome.Stage = CRT571_DISPENSE_WAIT_REMOVAL
+	timeout := time.NewTimer(steps.RemovalTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(steps.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if outcome.Status.Card == CRT571_CARD_NONE {
+			outcome.Stage = CRT571_DISPENSE_DONE
+			outcome.Taken = true
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return ErrRemovalTimeout
+		case <-ticker.C:
+		}
+		if outcome.Status, err = service.StatusContext(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Capture card after failed dispense
+func (service *CRT571Service) captureAfterFailure(ctx context.Context, outcome *CRT571DispenseOutcome) {
+	capture, status, err := service.captureLeftover(ctx, fmt.Sprintf("dispense failed on %s: %s", outcome.Stage, outcome.Err))
+	outcome.Capture = capture
+	if status.Card != CRT571_CARD_UNKNOWN {
+		outcome.Status = status
+	}
+	if err != nil {
+		outcome.CaptureErr = err
+		service.log.Error("Dispense(): capture failed", "error", err)
+		return
+	}
+	outcome.Captured = capture != nil
+}
@@ -0,0 +1,41 @@
+package crt571_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/syntech-pro/crt571"
+	"github.com/syntech-pro/crt571/simulator"
+)
+
+func TestDispenseCaptureOnFailure(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, ErrorBinCount: 2, Initialized: true})
+	dev.Fail(crt571.CRT571_CM_CARD_TYPE, "67")
+
+	outcome, err := service.Dispense(context.Background(), crt571.CRT571DispenseSteps{})
+	if !errors.Is(err, crt571.ErrICTransmission) {
+		t.Fatalf("Dispense() error: %v, want ErrICTransmission", err)
+	}
+	if outcome.Stage != crt571.CRT571_DISPENSE_CARD_TYPE || !outcome.Captured || outcome.CaptureErr != nil || outcome.Status.Card != crt571.CRT571_CARD_NONE {
+		t.Errorf("outcome %s, status %s, want captured on card type stage", outcome, outcome.Status)
+	}
+	if outcome.Capture == nil || outcome.Capture.BinCountBefore != 2 || outcome.Capture.BinCountAfter != 3 {
+		t.Errorf("capture %v, want error bin counter 2 -> 3", outcome.Capture)
+	}
+	if state := dev.State(); state.Position != simulator.PositionNone || state.StackerCards != 49 || state.ErrorBinCount != 3 {
+		t.Errorf("device state %+v, want card in error bin", state)
+	}
+}
+
+func TestDispenseEmptyStacker(t *testing.T) {
+	service, _ := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{Initialized: true})
+
+	outcome, err := service.Dispense(context.Background(), crt571.CRT571DispenseSteps{})
+	if !errors.Is(err, crt571.ErrEmptyStacker) {
+		t.Fatalf("Dispense() error: %v, want ErrEmptyStacker", err)
+	}
+	if outcome.Captured || outcome.Capture != nil {
+		t.Errorf("outcome %s, want nothing captured", outcome)
+	}
+}
@@ -0,0 +1,201 @@
+package crt571
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Device error codes (E1E0) usable with errors.Is:
+//
+//	if errors.Is(err, crt571.ErrCardJam) { ... }
+var (
+	ErrUndefinedCommand       = errors.New("crt571: reception of undefined command")
+	ErrCommandParameter       = errors.New("crt571: command parameter error")
+	ErrCommandSequence        = errors.New("crt571: command sequence error")
+	ErrUnsupportedCommand     = errors.New("crt571: out of hardware support command")
+	ErrCommandData            = errors.New("crt571: command data error")
+	ErrICContactNotReleased   = errors.New("crt571: IC card contact not release")
+	ErrCardJam                = errors.New("crt571: card jam")
+	ErrSensor                 = errors.New("crt571: sensor error")
+	ErrCardTooLong            = errors.New("crt571: too long card")
+	ErrCardTooShort           = errors.New("crt571: too short card")
+	ErrCardMovedManually      = errors.New("crt571: card moved manually")
+	ErrMoveWhenRecycling      = errors.New("crt571: move card when recycling")
+	ErrICMagnet               = errors.New("crt571: magnet of IC card error")
+	ErrICPositionDisabled     = errors.New("crt571: disable to move card to IC card position")
+	ErrCounterOverflow        = errors.New("crt571: received card counter overflow")
+	ErrMotor                  = errors.New("crt571: motor error")
+	ErrICShortCircuit         = errors.New("crt571: short circuit of IC card supply power")
+	ErrCardActivation         = errors.New("crt571: activation of card false")
+	ErrICCommandUnsupported   = errors.New("crt571: command out of IC card support")
+	ErrICCardDisabled         = errors.New("crt571: disability of IC card")
+	ErrICTransmission         = errors.New("crt571: IC card transmission error")
+	ErrICTransmissionOvertime = errors.New("crt571: IC card transmission overtime")
+	ErrEMVNonCompliance       = errors.New("crt571: CPU/SAM non-compliance to EMV standard")
+	ErrEmptyStacker           = errors.New("crt571: empty stacker")
+	ErrFullStacker            = errors.New("crt571: full stacker")
+	ErrNotReset               = errors.New("crt571: not reset")
+)
+
+// Sentinel errors by device error code
+var crt571ErrorSentinels = map[string]error{
+	"00": ErrUndefinedCommand,
+	"01": ErrCommandParameter,
+	"02": ErrCommandSequence,
+	"03": ErrUnsupportedCommand,
+	"04": ErrCommandData,
+	"05": ErrICContactNotReleased,
+	"10": ErrCardJam,
+	"12": ErrSensor,
+	"13": ErrCardTooLong,
+	"14": ErrCardTooShort,
+	"16": ErrCardMovedManually,
+	"40": ErrMoveWhenRecycling,
+	"41": ErrICMagnet,
+	"43": ErrICPositionDisabled,
+	"45": ErrCardMovedManually,
+	"50": ErrCounterOverflow,
+	"51": ErrMotor,
+	"60": ErrICShortCircuit,
+	"61": ErrCardActivation,
+	"62": ErrICCommandUnsupported,
+	"65": ErrICCardDisabled,
+	"66": ErrICCommandUnsupported,
+	"67": ErrICTransmission,
+	"68": ErrICTransmissionOvertime,
+	"69": ErrEMVNonCompliance,
+	"A0": ErrEmptyStacker,
+	"A1": ErrFullStacker,
+	"B0": ErrNotReset,
+}
+
+// Error response (EMT) of CRT-571
+type CRT571DeviceError struct {
+	Code     CRT571ErrorCode // Error code E1E0, e.g. "10"
+	CM       byte            // Failed command
+	PM       byte            // Failed command parameter
+	Message  string          // Message from CRT571Errors
+	Response *CRT571Response
+}
+
+func (e *CRT571DeviceError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = "Unknown error"
+	}
+	return fmt.Sprintf("crt571: %s (CM:%02x PM:%02x): %s (%s, %s)", CRT571Commands[e.CM], e.CM, e.PM, message, e.Code, e.Class())
+}
+
+// Match sentinel error of the code, e.g. ErrCardJam
+func (e *CRT571DeviceError) Is(target error) bool {
+	sentinel, ok := crt571ErrorSentinels[string(e.Code)]
+	return ok && sentinel == target
+}
+
+// Error class: retry, operator action or fatal
+func (e *CRT571DeviceError) Class() CRT571ErrorClass {
+	return e.Code.Class()
+}
+
+func newDeviceError(cm, pm byte, response *CRT571Response) *CRT571DeviceError {
+	return &CRT571DeviceError{
+		Code:     response.Code(),
+		CM:       cm,
+		PM:       pm,
+		Message:  response.ErrorMessage,
+		Response: response,
+	}
+}
+
+// How to handle device error
+type CRT571ErrorClass int
+
+const (
+	CRT571_ERROR_UNKNOWN         CRT571ErrorClass = iota // Code is not in catalogue
+	CRT571_ERROR_TRANSIENT                               // Retry command (after initialize if needed)
+	CRT571_ERROR_OPERATOR_ACTION                         // Operator must fix device: card jam, stacker empty, bin full
+	CRT571_ERROR_FATAL                                   // Hardware fault or unsupported command, retry will not help
+)
+
+func (class CRT571ErrorClass) String() string {
+	switch class {
+	case CRT571_ERROR_TRANSIENT:
+		return "transient"
+	case CRT571_ERROR_OPERATOR_ACTION:
+		return "operator action"
+	case CRT571_ERROR_FATAL:
+		return "fatal"
+	}
+	return "unknown"
+}
+
+// Error classes by device error code
+var CRT571ErrorClasses = map[string]CRT571ErrorClass{
+	"00": CRT571_ERROR_FATAL,
+	"01": CRT571_ERROR_FATAL,
+	"02": CRT571_ERROR_TRANSIENT,
+	"03": CRT571_ERROR_FATAL,
+	"04": CRT571_ERROR_TRANSIENT,
+	"05": CRT571_ERROR_TRANSIENT,
+	"10": CRT571_ERROR_OPERATOR_ACTION,
+	"12": CRT571_ERROR_FATAL,
+	"13": CRT571_ERROR_OPERATOR_ACTION,
+	"14": CRT571_ERROR_OPERATOR_ACTION,
+	"16": CRT571_ERROR_OPERATOR_ACTION,
+	"40": CRT571_ERROR_TRANSIENT,
+	"41": CRT571_ERROR_FATAL,
+	"43": CRT571_ERROR_FATAL,
+	"45": CRT571_ERROR_OPERATOR_ACTION,
+	"50": CRT571_ERROR_OPERATOR_ACTION,
+	"51": CRT571_ERROR_FATAL,
+	"60": CRT571_ERROR_OPERATOR_ACTION,
+	"61": CRT571_ERROR_TRANSIENT,
+	"62": CRT571_ERROR_FATAL,
+	"65": CRT571_ERROR_OPERATOR_ACTION,
+	"66": CRT571_ERROR_FATAL,
+	"67": CRT571_ERROR_TRANSIENT,
+	"68": CRT571_ERROR_TRANSIENT,
+	"69": CRT571_ERROR_FATAL,
+	"A0": CRT571_ERROR_OPERATOR_ACTION,
+	"A1": CRT571_ERROR_OPERATOR_ACTION,
+	"B0": CRT571_ERROR_TRANSIENT,
+}
+
+// Device error code E1E0 as upper case hex digits, e.g. "10", "A0".
+// Key of CRT571Errors and CRT571ErrorClasses.
+type CRT571ErrorCode string
+
+// Decode error code bytes E1, E0. Device sends ASCII hex digits ('A','0'),
+// binary nibbles (0x0a, 0x00) are accepted too.
+func DecodeErrorCode(e1, e0 byte) CRT571ErrorCode {
+	d1, ok1 := hexDigit(e1)
+	d0, ok0 := hexDigit(e0)
+	if ok1 && ok0 {
+		return CRT571ErrorCode([]byte{d1, d0})
+	}
+	if e1 < 0x10 && e0 < 0x10 {
+		return CRT571ErrorCode(fmt.Sprintf("%X%X", e1, e0))
+	}
+	return CRT571ErrorCode(fmt.Sprintf("%02X%02X", e1, e0))
+}
+
+// Upper case ASCII hex digit
+func hexDigit(b byte) (byte, bool) {
+	switch {
+	case b >= '0' && b <= '9', b >= 'A' && b <= 'F':
+		return b, true
+	case b >= 'a' && b <= 'f':
+		return b - 'a' + 'A', true
+	}
+	return 0, false
+}
+
+// Error message from CRT571Errors
+func (code CRT571ErrorCode) Message() string {
+	return CRT571Errors[string(code)]
+}
+
+// Error class from CRT571ErrorClasses
+func (code CRT571ErrorCode) Class() CRT571ErrorClass {
+	return CRT571ErrorClasses[string(code)]
+}
@@ -0,0 +1,112 @@
+package crt571
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+)
+
+// Items received from CRT-571
+const (
+	frameNone = iota // No complete item yet
+	frameACK         // ACK byte
+	frameNAK         // NAK byte
+	frameEOT         // EOT byte
+	frameData        // STX...ETX+BCC frame (or broken data, see idle())
+)
+
+// Streaming decoder of CRT-571 responses. Recognises ACK/NAK/EOT bytes
+// and STX ADDR LENH LENL ... ETX BCC frames, frame is complete when
+// LEN+6 bytes are received.
+type frameDecoder struct {
+	pending []byte
+	junk    []byte // Bytes out of frame
+}
+
+func (d *frameDecoder) write(data []byte) {
+	d.pending = append(d.pending, data...)
+}
+
+// Next complete item
+func (d *frameDecoder) next() (int, []byte) {
+	for len(d.pending) > 0 {
+		switch d.pending[0] {
+		case CRT571_ACK:
+			d.pending = d.pending[1:]
+			return frameACK, nil
+		case CRT571_NAK:
+			d.pending = d.pending[1:]
+			return frameNAK, nil
+		case CRT571_EOT:
+			d.pending = d.pending[1:]
+			return frameEOT, nil
+		case CRT571_STX:
+		default:
+			d.junk = append(d.junk, d.pending[0])
+			d.pending = d.pending[1:]
+			continue
+		}
+
+		if len(d.pending) < 4 {
+			return frameNone, nil
+		}
+		size := int(binary.BigEndian.Uint16(d.pending[2:4])) + 6
+		if size > CRT571_BUFFER_MAX_LENGTH {
+			d.junk = append(d.junk, d.pending[0])
+			d.pending = d.pending[1:]
+			continue
+		}
+		if len(d.pending) < size {
+			return frameNone, nil
+		}
+		frame := append([]byte(nil), d.pending[:size]...)
+		d.pending = d.pending[size:]
+		d.junk = nil
+		return frameData, frame
+	}
+	return frameNone, nil
+}
+
+// Line is idle (read timeout expired). Incomplete frame or junk bytes
+// are returned as broken data frame, so it fails BCC check and is requested again.
+func (d *frameDecoder) idle() (int, []byte) {
+	data := append(d.junk, d.pending...)
+	d.pending = nil
+	d.junk = nil
+	if len(data) == 0 {
+		return frameNone, nil
+	}
+	return frameData, data
+}
+
+// Read next item from device until ctx is done. ctx is checked every ReadTimeout.
+func (service *CRT571Service) readFrame(ctx context.Context, d *frameDecoder) (int, []byte, error) {
+	buf := make([]byte, CRT571_BUFFER_MAX_LENGTH)
+	for {
+		if kind, frame := d.next(); kind != frameNone {
+			return kind, frame, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return frameNone, nil, err
+		}
+
+		n, err := service.transport.Read(buf)
+		if n > 0 {
+			service.log.Debug("readFrame(): read buffer", "data", hexBytes(buf[:n]), "len", n)
+			d.write(buf[:n])
+		}
+		if err == io.EOF {
+			if kind, frame := d.next(); kind != frameNone {
+				return kind, frame, nil
+			}
+			if kind, frame := d.idle(); kind != frameNone {
+				return kind, frame, nil
+			}
+			continue
+		}
+		if err != nil {
+			service.log.Error("readFrame(): read error", "error", err)
+			return frameNone, nil, err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package crt571
+
+import (
+	"context"
+	"fmt"
+)
+
+// What INITIALIZE does with card inside CRT-571
+type CRT571InitCardAction int
+
+const (
+	CRT571_INIT_MOVE_TO_HOLD   CRT571InitCardAction = iota // Move card to card holding position
+	CRT571_INIT_CAPTURE_TO_BIN                             // Capture card to error card bin
+	CRT571_INIT_LEAVE_IN_PLACE                             // Do not move card
+)
+
+type CRT571InitOptions struct {
+	Card           CRT571InitCardAction
+	RetractCounter bool // Retract counter will work (captured card is counted)
+}
+
+type CRT571InitResult struct {
+	Status CRT571DeviceStatus
+	Data   []byte // Initialization data from firmware
+}
+
+// PM of INITIALIZE command for opts
+func (opts CRT571InitOptions) pm() (byte, error) {
+	switch opts.Card {
+	case CRT571_INIT_MOVE_TO_HOLD:
+		if opts.RetractCounter {
+			return CRT571_PM_INITIALIZE_MOVE_CARD_RETRACT, nil
+		}
+		return CRT571_PM_INITIALIZE_MOVE_CARD, nil
+	case CRT571_INIT_CAPTURE_TO_BIN:
+		if opts.RetractCounter {
+			return CRT571_PM_INITIALIZE_CAPTURE_CARD_RETRACT, nil
+		}
+		return CRT571_PM_INITIALIZE_CAPTURE_CARD, nil
+	case CRT571_INIT_LEAVE_IN_PLACE:
+		if opts.RetractCounter {
+			return CRT571_PM_INITIALIZE_DONT_MOVE_CARD_RETRACT, nil
+		}
+		return CRT571_PM_INITIALIZE_DONT_MOVE_CARD, nil
+	}
+	return 0, fmt.Errorf("crt571: unknown initialize card action %d", opts.Card)
+}
+
+// Initialize CRT-571
+func (service *CRT571Service) Initialize(opts CRT571InitOptions) (*CRT571InitResult, error) {
+	return service.InitializeContext(context.Background(), opts)
+}
+
+// Initialize CRT-571 with context
+func (service *CRT571Service) InitializeContext(ctx context.Context, opts CRT571InitOptions) (*CRT571InitResult, error) {
+	pm, err := opts.pm()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := service.CommandContext(ctx, CRT571_CM_INITIALIZE, pm, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CRT571InitResult{Status: res.DeviceStatus(), Data: res.Data}, nil
+}
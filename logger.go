@@ -0,0 +1,53 @@
+package crt571
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Leveled structured logger, *slog.Logger satisfies it.
+// args are key-value pairs as in log/slog.
+type CRT571Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Silent default logger
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...any) {}
+func (nopLogger) Info(msg string, args ...any)  {}
+func (nopLogger) Warn(msg string, args ...any)  {}
+func (nopLogger) Error(msg string, args ...any) {}
+
+func loggerOf(config CRT571Config) CRT571Logger {
+	if config.Logger == nil {
+		return nopLogger{}
+	}
+	return config.Logger
+}
+
+// Hex dump formatted only when log record is written. slog handlers use
+// LogValue, other loggers String.
+type hexBytes []byte
+
+func (h hexBytes) String() string {
+	return fmt.Sprintf("% x", []byte(h))
+}
+
+func (h hexBytes) LogValue() slog.Value {
+	return slog.StringValue(h.String())
+}
+
+// Byte formatted as hex, e.g. CM/PM
+type hexByte byte
+
+func (h hexByte) String() string {
+	return fmt.Sprintf("%02x", byte(h))
+}
+
+func (h hexByte) LogValue() slog.Value {
+	return slog.StringValue(h.String())
+}
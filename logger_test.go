@@ -0,0 +1,33 @@
+package crt571
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggerHex(t *testing.T) {
+	frame := hexBytes{CRT571_STX, 0x00, 0x00, 0x03, CRT571_CMT, 0x31, 0x30, CRT571_ETX, 0xb0}
+
+	for _, tc := range []struct {
+		name    string
+		handler func(buf *bytes.Buffer) slog.Handler
+		want    []string
+	}{
+		{"text", func(buf *bytes.Buffer) slog.Handler { return slog.NewTextHandler(buf, nil) },
+			[]string{`data="f2 00 00 03 43 31 30 03 b0"`, `cm=31`}},
+		{"json", func(buf *bytes.Buffer) slog.Handler { return slog.NewJSONHandler(buf, nil) },
+			[]string{`"data":"f2 00 00 03 43 31 30 03 b0"`, `"cm":"31"`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			slog.New(tc.handler(&buf)).Info("request", "data", frame, "cm", hexByte(CRT571_CM_STATUS_REQUEST))
+			for _, want := range tc.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("log record %q does not contain %q", buf.String(), want)
+				}
+			}
+		})
+	}
+}
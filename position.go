@@ -0,0 +1,190 @@
+package crt571
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Card position inside CRT-571 tracked by service
+type CRT571Position int
+
+const (
+	CRT571_POSITION_UNKNOWN   CRT571Position = iota // No status received yet
+	CRT571_POSITION_NONE                            // No card in device
+	CRT571_POSITION_INSIDE                          // Card on RF/IC card position, exact position unknown
+	CRT571_POSITION_HOLD                            // Card holding position
+	CRT571_POSITION_IC                              // IC card position (IC contacts)
+	CRT571_POSITION_RF                              // RF card position
+	CRT571_POSITION_ERROR_BIN                       // Error card bin (move target only)
+	CRT571_POSITION_GATE                            // Output gate
+)
+
+// Requested card movement is not possible in current position
+var ErrIllegalMove = errors.New("crt571: illegal card move")
+
+func (position CRT571Position) String() string {
+	switch position {
+	case CRT571_POSITION_NONE:
+		return "no card"
+	case CRT571_POSITION_INSIDE:
+		return "RF/IC card position"
+	case CRT571_POSITION_HOLD:
+		return "card holding position"
+	case CRT571_POSITION_IC:
+		return "IC card position"
+	case CRT571_POSITION_RF:
+		return "RF card position"
+	case CRT571_POSITION_ERROR_BIN:
+		return "error card bin"
+	case CRT571_POSITION_GATE:
+		return "gate"
+	}
+	return "unknown"
+}
+
+// PM of CARD_MOVE command to position
+var crt571MovePM = map[CRT571Position]byte{
+	CRT571_POSITION_HOLD:      CRT571_PM_CARD_MOVE_HOLD,
+	CRT571_POSITION_IC:        CRT571_PM_CARD_MOVE_IC_POS,
+	CRT571_POSITION_RF:        CRT571_PM_CARD_MOVE_RF_POS,
+	CRT571_POSITION_ERROR_BIN: CRT571_PM_CARD_MOVE_ERROR_BIN,
+	CRT571_POSITION_GATE:      CRT571_PM_CARD_MOVE_GATE,
+}
+
+// Card position and status from last response, shared by service copies
+type positionTracker struct {
+	mu       sync.Mutex
+	position CRT571Position
+	status   CRT571DeviceStatus
+	captured bool // Last card left device to error card bin
+}
+
+// Update position from response to command cm/pm
+func (t *positionTracker) update(cm, pm byte, status CRT571DeviceStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status = status
+	switch status.Card {
+	case CRT571_CARD_NONE:
+		if capturesCard(cm, pm) {
+			t.captured = true
+		} else if t.position != CRT571_POSITION_NONE {
+			t.captured = false
+		}
+		t.position = CRT571_POSITION_NONE
+	case CRT571_CARD_IN_GATE:
+		t.captured = false
+		t.position = CRT571_POSITION_GATE
+	case CRT571_CARD_ON_POSITION:
+		t.captured = false
+		if position := positionOfCommand(cm, pm); position != CRT571_POSITION_UNKNOWN {
+			t.position = position
+		} else if t.position != CRT571_POSITION_HOLD && t.position != CRT571_POSITION_IC && t.position != CRT571_POSITION_RF {
+			t.position = CRT571_POSITION_INSIDE
+		}
+	}
+}
+
+func (t *positionTracker) get() (CRT571Position, CRT571DeviceStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.position, t.status
+}
+
+// Card left device to error card bin, not taken from gate
+func (t *positionTracker) cardCaptured() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.captured
+}
+
+// Command cm/pm moves card to error card bin
+func capturesCard(cm, pm byte) bool {
+	switch cm {
+	case CRT571_CM_CARD_MOVE:
+		return pm == CRT571_PM_CARD_MOVE_ERROR_BIN
+	case CRT571_CM_INITIALIZE:
+		return pm == CRT571_PM_INITIALIZE_CAPTURE_CARD || pm == CRT571_PM_INITIALIZE_CAPTURE_CARD_RETRACT
+	}
+	return false
+}
+
+// Position of card on RF/IC card position after command cm/pm
+func positionOfCommand(cm, pm byte) CRT571Position {
+	switch cm {
+	case CRT571_CM_CARD_MOVE:
+		switch pm {
+		case CRT571_PM_CARD_MOVE_HOLD:
+			return CRT571_POSITION_HOLD
+		case CRT571_PM_CARD_MOVE_IC_POS:
+			return CRT571_POSITION_IC
+		case CRT571_PM_CARD_MOVE_RF_POS:
+			return CRT571_POSITION_RF
+		}
+	case CRT571_CM_INITIALIZE:
+		switch pm {
+		case CRT571_PM_INITIALIZE_MOVE_CARD, CRT571_PM_INITIALIZE_MOVE_CARD_RETRACT:
+			return CRT571_POSITION_HOLD
+		}
+	}
+	return CRT571_POSITION_UNKNOWN
+}
+
+// Check that card can be moved from position to target
+func checkMove(position CRT571Position, status CRT571DeviceStatus, target CRT571Position) error {
+	if _, ok := crt571MovePM[target]; !ok {
+		return fmt.Errorf("%w: unknown target position %d", ErrIllegalMove, target)
+	}
+
+	switch position {
+	case CRT571_POSITION_NONE:
+		if target == CRT571_POSITION_ERROR_BIN {
+			return fmt.Errorf("%w: no card to move to %s", ErrIllegalMove, target)
+		}
+		// card is fed from stacker
+		if status.Stacker == CRT571_STACKER_EMPTY {
+			return fmt.Errorf("%w: %w: no card in stacker to move to %s", ErrIllegalMove, ErrEmptyStacker, target)
+		}
+	case CRT571_POSITION_GATE:
+		if target == CRT571_POSITION_GATE {
+			return fmt.Errorf("%w: card is already in %s", ErrIllegalMove, target)
+		}
+	}
+	return nil
+}
+
+// Last known card position
+func (service *CRT571Service) CurrentPosition() CRT571Position {
+	if service.tracker == nil {
+		return CRT571_POSITION_UNKNOWN
+	}
+	position, _ := service.tracker.get()
+	return position
+}
+
+// Move card to position: CRT571_POSITION_HOLD, _IC, _RF, _ERROR_BIN or _GATE.
+// If there is no card inside, card is fed from stacker.
+func (service *CRT571Service) MoveTo(position CRT571Position) (CRT571DeviceStatus, error) {
+	return service.MoveToContext(context.Background(), position)
+}
+
+// Move card to position with context
+func (service *CRT571Service) MoveToContext(ctx context.Context, position CRT571Position) (CRT571DeviceStatus, error) {
+	if service.tracker == nil {
+		return CRT571DeviceStatus{}, ErrNotConnected
+	}
+
+	current, status := service.tracker.get()
+	if err := checkMove(current, status, position); err != nil {
+		return CRT571DeviceStatus{}, err
+	}
+
+	res, err := service.CommandContext(ctx, CRT571_CM_CARD_MOVE, crt571MovePM[position], nil)
+	if err != nil {
+		return CRT571DeviceStatus{}, err
+	}
+	return res.DeviceStatus(), nil
+}
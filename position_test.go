@@ -0,0 +1,73 @@
+package crt571
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckMove(t *testing.T) {
+	stacked := CRT571DeviceStatus{Stacker: CRT571_STACKER_ENOUGH}
+	empty := CRT571DeviceStatus{Stacker: CRT571_STACKER_EMPTY}
+
+	for _, tc := range []struct {
+		position CRT571Position
+		status   CRT571DeviceStatus
+		target   CRT571Position
+		err      error
+	}{
+		{CRT571_POSITION_UNKNOWN, CRT571DeviceStatus{}, CRT571_POSITION_IC, nil},
+		{CRT571_POSITION_NONE, stacked, CRT571_POSITION_HOLD, nil},
+		{CRT571_POSITION_NONE, stacked, CRT571_POSITION_IC, nil},
+		{CRT571_POSITION_NONE, stacked, CRT571_POSITION_RF, nil},
+		{CRT571_POSITION_NONE, stacked, CRT571_POSITION_GATE, nil},
+		{CRT571_POSITION_NONE, stacked, CRT571_POSITION_ERROR_BIN, ErrIllegalMove},
+		{CRT571_POSITION_NONE, empty, CRT571_POSITION_IC, ErrEmptyStacker},
+		{CRT571_POSITION_NONE, empty, CRT571_POSITION_GATE, ErrIllegalMove},
+		{CRT571_POSITION_HOLD, empty, CRT571_POSITION_IC, nil},
+		{CRT571_POSITION_IC, stacked, CRT571_POSITION_RF, nil},
+		{CRT571_POSITION_RF, stacked, CRT571_POSITION_GATE, nil},
+		{CRT571_POSITION_INSIDE, stacked, CRT571_POSITION_ERROR_BIN, nil},
+		{CRT571_POSITION_GATE, stacked, CRT571_POSITION_GATE, ErrIllegalMove},
+		{CRT571_POSITION_GATE, stacked, CRT571_POSITION_IC, nil},
+		{CRT571_POSITION_GATE, stacked, CRT571_POSITION_ERROR_BIN, nil},
+		{CRT571_POSITION_HOLD, stacked, CRT571_POSITION_NONE, ErrIllegalMove},
+		{CRT571_POSITION_HOLD, stacked, CRT571_POSITION_INSIDE, ErrIllegalMove},
+	} {
+		err := checkMove(tc.position, tc.status, tc.target)
+		if !errors.Is(err, tc.err) || (tc.err == nil) != (err == nil) {
+			t.Errorf("checkMove(%s, stacker %s, %s) = %v, want %v", tc.position, tc.status.Stacker, tc.target, err, tc.err)
+		}
+	}
+
+	// Empty stacker matches both sentinels
+	err := checkMove(CRT571_POSITION_NONE, empty, CRT571_POSITION_IC)
+	if !errors.Is(err, ErrIllegalMove) || !errors.Is(err, ErrEmptyStacker) {
+		t.Errorf("checkMove() from empty stacker = %v, want ErrIllegalMove and ErrEmptyStacker", err)
+	}
+}
+
+func TestPositionTracker(t *testing.T) {
+	onPosition := []byte{CRT571_ST0_ONE_CARD_ON_POSITION, CRT571_ST1_ENOUGH_CARDS_IN_BOX, CRT571_ST2_ERROR_CARD_BIN_NOT_FULL}
+	inGate := []byte{CRT571_ST0_ONE_CARD_IN_GATE, CRT571_ST1_ENOUGH_CARDS_IN_BOX, CRT571_ST2_ERROR_CARD_BIN_NOT_FULL}
+	noCard := []byte{CRT571_ST0_NO_CARD, CRT571_ST1_ENOUGH_CARDS_IN_BOX, CRT571_ST2_ERROR_CARD_BIN_NOT_FULL}
+
+	var tracker positionTracker
+	for _, step := range []struct {
+		cm, pm byte
+		st     []byte
+		want   CRT571Position
+	}{
+		{CRT571_CM_STATUS_REQUEST, CRT571_PM_STATUS_DEVICE, onPosition, CRT571_POSITION_INSIDE},
+		{CRT571_CM_CARD_MOVE, CRT571_PM_CARD_MOVE_IC_POS, onPosition, CRT571_POSITION_IC},
+		{CRT571_CM_STATUS_REQUEST, CRT571_PM_STATUS_DEVICE, onPosition, CRT571_POSITION_IC},
+		{CRT571_CM_CARD_MOVE, CRT571_PM_CARD_MOVE_RF_POS, onPosition, CRT571_POSITION_RF},
+		{CRT571_CM_CARD_MOVE, CRT571_PM_CARD_MOVE_GATE, inGate, CRT571_POSITION_GATE},
+		{CRT571_CM_INITIALIZE, CRT571_PM_INITIALIZE_MOVE_CARD, onPosition, CRT571_POSITION_HOLD},
+		{CRT571_CM_CARD_MOVE, CRT571_PM_CARD_MOVE_ERROR_BIN, noCard, CRT571_POSITION_NONE},
+	} {
+		tracker.update(step.cm, step.pm, parseDeviceStatus(step.st))
+		if position, _ := tracker.get(); position != step.want {
+			t.Errorf("position after CM:%02x PM:%02x = %s, want %s", step.cm, step.pm, position, step.want)
+		}
+	}
+}
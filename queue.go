@@ -0,0 +1,149 @@
+package crt571
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Command priority in service queue. Queued commands of higher priority
+// are sent to device first, command in progress is never interrupted.
+type CRT571Priority int
+
+const (
+	CRT571_PRIORITY_LOW    CRT571Priority = iota // Status polls (default for STATUS_REQUEST)
+	CRT571_PRIORITY_NORMAL                       // Default for other commands
+	CRT571_PRIORITY_HIGH                         // Card dispense, payment flow
+)
+
+// Service was closed
+var ErrClosed = errors.New("crt571: service is closed")
+
+type priorityKey struct{}
+
+// Context with command priority for CommandContext
+func WithPriority(ctx context.Context, priority CRT571Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// Priority of ctx kept by card and SAM handles for operations without ctx
+type handlePriority struct {
+	priority CRT571Priority
+	set      bool
+}
+
+func newHandlePriority(ctx context.Context) handlePriority {
+	priority, ok := ctx.Value(priorityKey{}).(CRT571Priority)
+	return handlePriority{priority: priority, set: ok}
+}
+
+// Context of operations without ctx: no deadline, priority of handle
+func (handle handlePriority) background() context.Context {
+	if handle.set {
+		return WithPriority(context.Background(), handle.priority)
+	}
+	return context.Background()
+}
+
+// Priority from ctx or default priority of command cm
+func priorityOf(ctx context.Context, cm byte) CRT571Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(CRT571Priority); ok && priority >= CRT571_PRIORITY_LOW && priority <= CRT571_PRIORITY_HIGH {
+		return priority
+	}
+	if cm == CRT571_CM_STATUS_REQUEST {
+		return CRT571_PRIORITY_LOW
+	}
+	return CRT571_PRIORITY_NORMAL
+}
+
+type commandJob struct {
+	ctx    context.Context
+	cm     byte
+	pm     byte
+	data   []byte
+	result chan commandResult
+}
+
+type commandResult struct {
+	res *CRT571Response
+	err error
+}
+
+// Commands queue served by single worker goroutine,
+// so only one exchange with device is in progress
+type commandQueue struct {
+	jobs      [CRT571_PRIORITY_HIGH + 1]chan *commandJob
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newCommandQueue() *commandQueue {
+	q := &commandQueue{done: make(chan struct{})}
+	for i := range q.jobs {
+		q.jobs[i] = make(chan *commandJob)
+	}
+	return q
+}
+
+// Worker loop, runs until queue is closed
+func (q *commandQueue) serve(command func(ctx context.Context, cm, pm byte, data []byte) (*CRT571Response, error)) {
+	for {
+		job := q.next()
+		if job == nil {
+			return
+		}
+		if err := job.ctx.Err(); err != nil {
+			job.result <- commandResult{err: err}
+			continue
+		}
+		res, err := command(job.ctx, job.cm, job.pm, job.data)
+		job.result <- commandResult{res: res, err: err}
+	}
+}
+
+// Next job of highest priority, nil if queue is closed
+func (q *commandQueue) next() *commandJob {
+	for p := CRT571_PRIORITY_HIGH; p >= CRT571_PRIORITY_LOW; p-- {
+		select {
+		case job := <-q.jobs[p]:
+			return job
+		default:
+		}
+	}
+	select {
+	case job := <-q.jobs[CRT571_PRIORITY_HIGH]:
+		return job
+	case job := <-q.jobs[CRT571_PRIORITY_NORMAL]:
+		return job
+	case job := <-q.jobs[CRT571_PRIORITY_LOW]:
+		return job
+	case <-q.done:
+		return nil
+	}
+}
+
+// Queue command and wait for its result
+func (q *commandQueue) submit(ctx context.Context, cm, pm byte, data []byte) (*CRT571Response, error) {
+	job := &commandJob{ctx: ctx, cm: cm, pm: pm, data: data, result: make(chan commandResult, 1)}
+
+	select {
+	case q.jobs[priorityOf(ctx, cm)] <- job:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-q.done:
+		return nil, ErrClosed
+	}
+
+	select {
+	case r := <-job.result:
+		return r.res, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-q.done:
+		return nil, ErrClosed
+	}
+}
+
+func (q *commandQueue) close() {
+	q.closeOnce.Do(func() { close(q.done) })
+}
@@ -0,0 +1,55 @@
+package crt571
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueuePriority(t *testing.T) {
+	q := newCommandQueue()
+	defer q.close()
+
+	var mu sync.Mutex
+	var order []byte
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go q.serve(func(ctx context.Context, cm, pm byte, data []byte) (*CRT571Response, error) {
+		mu.Lock()
+		order = append(order, cm)
+		mu.Unlock()
+		if cm == CRT571_CM_INITIALIZE {
+			close(started)
+			<-release
+		}
+		return &CRT571Response{Type: CRT571_PMT}, nil
+	})
+
+	var wg sync.WaitGroup
+	submit := func(ctx context.Context, cm byte) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := q.submit(ctx, cm, 0x30, nil); err != nil {
+				t.Errorf("submit(%02x) error: %v", cm, err)
+			}
+		}()
+	}
+
+	// Worker is busy, LOW job is queued before HIGH job
+	submit(context.Background(), CRT571_CM_INITIALIZE)
+	<-started
+	submit(context.Background(), CRT571_CM_STATUS_REQUEST)
+	time.Sleep(20 * time.Millisecond)
+	submit(WithPriority(context.Background(), CRT571_PRIORITY_HIGH), CRT571_CM_CARD_MOVE)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	want := []byte{CRT571_CM_INITIALIZE, CRT571_CM_CARD_MOVE, CRT571_CM_STATUS_REQUEST}
+	if !bytes.Equal(order, want) {
+		t.Errorf("commands executed in order [% x], want [% x]", order, want)
+	}
+}
@@ -0,0 +1,94 @@
+package crt571
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Response frame is malformed, errors.Is matches any *CRT571ProtocolError
+var ErrProtocol = errors.New("crt571: protocol error")
+
+// Malformed response frame
+type CRT571ProtocolError struct {
+	Reason string
+	Frame  []byte
+}
+
+func (e *CRT571ProtocolError) Error() string {
+	return fmt.Sprintf("%s: %s, frame:[% x]", ErrProtocol, e.Reason, e.Frame)
+}
+
+func (e *CRT571ProtocolError) Is(target error) bool {
+	return target == ErrProtocol
+}
+
+func protocolError(frame []byte, format string, args ...any) error {
+	return &CRT571ProtocolError{Reason: fmt.Sprintf(format, args...), Frame: frame}
+}
+
+// Minimal LEN of response frames
+const (
+	responsePMTMinLen = 6 // PMT CM PM ST0 ST1 ST2
+	responseEMTMinLen = 5 // EMT CM PM E1 E0
+)
+
+// Parse response frame to command cm/pm:
+//
+//	positive: STX ADDR LENH LENL PMT CM PM ST0 ST1 ST2 DATA ETX BCC
+//	negative: STX ADDR LENH LENL EMT CM PM E1 E0 DATA ETX BCC
+//
+// BCC is checked by exchange().
+func parseResponse(frame []byte, address, cm, pm byte) (*CRT571Response, error) {
+	var response CRT571Response
+
+	// STX ADDR LENH LENL TYPE CM PM ETX BCC
+	if len(frame) < 9 {
+		return nil, protocolError(frame, "frame too short (%d bytes)", len(frame))
+	}
+	if frame[0] != CRT571_STX {
+		return nil, protocolError(frame, "STX expected, got %02x", frame[0])
+	}
+	if frame[1] != address {
+		return nil, protocolError(frame, "address %02x expected, got %02x", address, frame[1])
+	}
+	datalen := int(binary.BigEndian.Uint16(frame[2:4]))
+	if datalen+6 != len(frame) {
+		return nil, protocolError(frame, "LEN %d does not match frame size %d", datalen, len(frame))
+	}
+	if frame[len(frame)-2] != CRT571_ETX {
+		return nil, protocolError(frame, "ETX expected, got %02x", frame[len(frame)-2])
+	}
+	if frame[5] != cm || frame[6] != pm {
+		return nil, protocolError(frame, "response to CM:%02x PM:%02x, expected CM:%02x PM:%02x", frame[5], frame[6], cm, pm)
+	}
+
+	response.DataLen = datalen
+	response.Type = frame[4]
+	body := frame[4 : len(frame)-2]
+
+	switch response.Type {
+	case CRT571_PMT: // Positve response
+		if datalen < responsePMTMinLen {
+			return nil, protocolError(frame, "positive response LEN %d, minimum %d", datalen, responsePMTMinLen)
+		}
+		response.CardStatus = body[3:6]
+		response.ST0Message = CRT571CardStatus["ST0"][body[3]]
+		response.ST1Message = CRT571CardStatus["ST1"][body[4]]
+		response.ST2Message = CRT571CardStatus["ST2"][body[5]]
+		response.Data = body[6:]
+
+	case CRT571_EMT, CRT571_EMT2: // Failed response
+		if datalen < responseEMTMinLen {
+			return nil, protocolError(frame, "negative response LEN %d, minimum %d", datalen, responseEMTMinLen)
+		}
+		response.ErrorCode = body[3:5]
+		response.ErrorMessage = response.Code().Message()
+		response.Data = body[5:]
+
+	default:
+		return nil, protocolError(frame, "unknown response type %02x", response.Type)
+	}
+
+	return &response, nil
+}
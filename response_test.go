@@ -0,0 +1,70 @@
+package crt571
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func FuzzParseResponse(f *testing.F) {
+	cm, pm := CRT571_CM_STATUS_REQUEST, CRT571_PM_STATUS_DEVICE
+	f.Add(testFrame(0, CRT571_PMT, cm, pm, CRT571_ST0_NO_CARD, CRT571_ST1_ENOUGH_CARDS_IN_BOX, CRT571_ST2_ERROR_CARD_BIN_NOT_FULL), byte(0), cm, pm)
+	f.Add(testFrame(0, CRT571_PMT, cm, pm, '0', '2', '0', 'D', 'A', 'T', 'A'), byte(0), cm, pm)
+	f.Add(testFrame(0, CRT571_EMT2, cm, pm, '1', '0'), byte(0), cm, pm)
+	f.Add(testFrame(0, CRT571_EMT, cm, pm, 0x0a, 0x00), byte(0), cm, pm)
+	f.Add(testFrame(0, CRT571_PMT, cm, pm), byte(0), cm, pm)                                     // short positive
+	f.Add(testFrame(0, CRT571_EMT, cm, pm, '1'), byte(0), cm, pm)                                // short negative
+	f.Add([]byte{CRT571_STX, 0, 0, 3}, byte(0), cm, pm)                                          // short frame
+	f.Add([]byte{CRT571_STX, 0, 0xff, 0xff, CRT571_PMT, cm, pm, CRT571_ETX, 0}, byte(0), cm, pm) // wrong LEN
+	f.Add([]byte{CRT571_ACK, CRT571_STX, CRT571_NAK, 0x41, CRT571_EOT, CRT571_STX, 0, 0}, byte(0), cm, pm)
+	f.Add([]byte{}, byte(0), cm, pm)
+
+	f.Fuzz(func(t *testing.T, frame []byte, address, cm, pm byte) {
+		if response, err := parseResponse(frame, address, cm, pm); err == nil {
+			switch response.Type {
+			case CRT571_PMT:
+				if len(response.CardStatus) != 3 {
+					t.Fatalf("positive response card status [% x]", response.CardStatus)
+				}
+			case CRT571_EMT, CRT571_EMT2:
+				if len(response.ErrorCode) != 2 {
+					t.Fatalf("negative response error code [% x]", response.ErrorCode)
+				}
+			default:
+				t.Fatalf("response type %02x accepted", response.Type)
+			}
+			_ = response.String()
+		}
+
+		// Same bytes fed to decoder in chunks, then line goes idle
+		var d frameDecoder
+		received := 0
+		for i := 0; i < len(frame); i += 7 {
+			d.write(frame[i:min(i+7, len(frame))])
+			for {
+				kind, data := d.next()
+				if kind == frameNone {
+					break
+				}
+				if kind == frameData {
+					size := int(binary.BigEndian.Uint16(data[2:4])) + 6
+					if data[0] != CRT571_STX || len(data) != size || size > CRT571_BUFFER_MAX_LENGTH {
+						t.Fatalf("decoded frame [% x]", data)
+					}
+					received += len(data)
+				} else {
+					received++
+				}
+			}
+		}
+		kind, data := d.idle()
+		if kind == frameData {
+			received += len(data)
+		}
+		if received > len(frame) {
+			t.Fatalf("decoded %d bytes of %d", received, len(frame))
+		}
+		if kind, _ := d.idle(); kind != frameNone {
+			t.Fatalf("decoder is not empty after idle")
+		}
+	})
+}
@@ -0,0 +1,240 @@
+package crt571
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Number of SAM card stands
+const CRT571_SAM_SLOTS = 4
+
+// SAM slot number is out of range 1-CRT571_SAM_SLOTS
+var ErrSAMSlot = errors.New("crt571: invalid SAM slot")
+
+// Active SAM slot shared by copies of service. Lock mu is held while a SAM
+// operation selects its slot and runs, so operations on different slots
+// do not interleave. Active slot is tracked by queue worker from every
+// executed command (see update), it has its own lock.
+type samState struct {
+	mu  sync.Mutex
+	atr [CRT571_SAM_SLOTS + 1]*CRT571ATR
+
+	slotMu sync.Mutex
+	slot   int // Active slot, 0 if unknown
+}
+
+// Track active slot after command cm/pm with command data, called by queue
+// worker. STAND selects slot, INITIALIZE and lost link (device may be power
+// cycled) make it unknown.
+func (state *samState) update(cm, pm byte, data []byte, err error) {
+	var deviceErr *CRT571DeviceError
+	state.slotMu.Lock()
+	defer state.slotMu.Unlock()
+
+	switch {
+	case cm == CRT571_CM_INITIALIZE:
+		state.slot = 0
+	case cm == CRT571_CM_SAM_CARD_CONTROL && pm == CRT571_PM_SAMCARD_CONTROL_STAND:
+		state.slot = 0
+		if err == nil && len(data) == 1 && data[0] >= '1' && data[0] <= '0'+CRT571_SAM_SLOTS {
+			state.slot = int(data[0] - '0')
+		}
+	case err != nil && !errors.As(err, &deviceErr):
+		state.slot = 0
+	}
+}
+
+func (state *samState) activeSlot() int {
+	state.slotMu.Lock()
+	defer state.slotMu.Unlock()
+	return state.slot
+}
+
+// SAM card in slot 1-CRT571_SAM_SLOTS
+type CRT571SAM struct {
+	handlePriority
+	service *CRT571Service
+	slot    int
+}
+
+// SAM card handle for slot. Slot is selected before every operation on it.
+func (service *CRT571Service) SAM(slot int) (*CRT571SAM, error) {
+	return service.SAMContext(context.Background(), slot)
+}
+
+// SAM card handle for slot with context. Operations without ctx are queued
+// with priority of ctx, ...Context variants run with their own ctx.
+func (service *CRT571Service) SAMContext(ctx context.Context, slot int) (*CRT571SAM, error) {
+	if slot < 1 || slot > CRT571_SAM_SLOTS {
+		return nil, fmt.Errorf("%w: %d", ErrSAMSlot, slot)
+	}
+	if service.sam == nil {
+		return nil, ErrNotConnected
+	}
+	return &CRT571SAM{handlePriority: newHandlePriority(ctx), service: service, slot: slot}, nil
+}
+
+// Select active SAM slot (choose SAMCard stand). Data is slot number as ASCII digit.
+func (service *CRT571Service) SelectSlot(slot int) error {
+	return service.SelectSlotContext(context.Background(), slot)
+}
+
+// Select active SAM slot with context
+func (service *CRT571Service) SelectSlotContext(ctx context.Context, slot int) error {
+	if slot < 1 || slot > CRT571_SAM_SLOTS {
+		return fmt.Errorf("%w: %d", ErrSAMSlot, slot)
+	}
+	if service.sam == nil {
+		return ErrNotConnected
+	}
+	service.sam.mu.Lock()
+	defer service.sam.mu.Unlock()
+	return service.selectSlot(ctx, slot)
+}
+
+// Active SAM slot, 0 if unknown
+func (service *CRT571Service) ActiveSlot() int {
+	if service.sam == nil {
+		return 0
+	}
+	return service.sam.activeSlot()
+}
+
+// Select slot, sam.mu must be held
+func (service *CRT571Service) selectSlot(ctx context.Context, slot int) error {
+	if service.sam.activeSlot() == slot {
+		return nil
+	}
+	if _, err := service.CommandContext(ctx, CRT571_CM_SAM_CARD_CONTROL, CRT571_PM_SAMCARD_CONTROL_STAND, []byte{'0' + byte(slot)}); err != nil {
+		return err
+	}
+	service.log.Debug("SAM: slot selected", "slot", slot)
+	return nil
+}
+
+// Select slot of SAM and run command on it
+func (sam *CRT571SAM) command(ctx context.Context, pm byte, data []byte) ([]byte, error) {
+	state := sam.service.sam
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if err := sam.service.selectSlot(ctx, sam.slot); err != nil {
+		return nil, err
+	}
+	res, err := sam.service.CommandContext(ctx, CRT571_CM_SAM_CARD_CONTROL, pm, data)
+	if err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
+
+// SAM slot number
+func (sam *CRT571SAM) Slot() int {
+	return sam.slot
+}
+
+// Cold reset (activate) SAM, returns answer to reset
+func (sam *CRT571SAM) ColdReset() (*CRT571ATR, error) {
+	return sam.ColdResetContext(sam.background())
+}
+
+// Cold reset SAM with context
+func (sam *CRT571SAM) ColdResetContext(ctx context.Context) (*CRT571ATR, error) {
+	return sam.reset(ctx, CRT571_PM_SAMCARD_CONTROL_COLD_RESET)
+}
+
+// Warm (hot) reset of activated SAM, returns answer to reset
+func (sam *CRT571SAM) WarmReset() (*CRT571ATR, error) {
+	return sam.WarmResetContext(sam.background())
+}
+
+// Warm reset SAM with context
+func (sam *CRT571SAM) WarmResetContext(ctx context.Context) (*CRT571ATR, error) {
+	return sam.reset(ctx, CRT571_PM_SAMCARD_CONTROL_HOT_RESET)
+}
+
+func (sam *CRT571SAM) reset(ctx context.Context, pm byte) (*CRT571ATR, error) {
+	sam.setATR(nil)
+	data, err := sam.command(ctx, pm, nil)
+	if err != nil {
+		return nil, err
+	}
+	atr, err := parseResetATR(data)
+	if err != nil {
+		return nil, err
+	}
+	sam.service.log.Debug("SAM: reset", "slot", sam.slot, "atr", atr)
+	sam.setATR(atr)
+	return atr, nil
+}
+
+// Answer to reset of last reset of slot, nil before reset
+func (sam *CRT571SAM) ATR() *CRT571ATR {
+	sam.service.sam.mu.Lock()
+	defer sam.service.sam.mu.Unlock()
+	return sam.service.sam.atr[sam.slot]
+}
+
+func (sam *CRT571SAM) setATR(atr *CRT571ATR) {
+	sam.service.sam.mu.Lock()
+	defer sam.service.sam.mu.Unlock()
+	sam.service.sam.atr[sam.slot] = atr
+}
+
+// SAM status check
+func (sam *CRT571SAM) Status() ([]byte, error) {
+	return sam.StatusContext(sam.background())
+}
+
+// SAM status check with context
+func (sam *CRT571SAM) StatusContext(ctx context.Context) ([]byte, error) {
+	return sam.command(ctx, CRT571_PM_SAMCARD_CONTROL_STATUS_CHECK, nil)
+}
+
+// Exchange APDU, returns response APDU. APDU exchange PM is chosen by
+// protocol of ATR: T=0, T=1 or auto distinguish if SAM was not reset.
+func (sam *CRT571SAM) Transmit(apdu []byte) ([]byte, error) {
+	return sam.TransmitContext(sam.background(), apdu)
+}
+
+// Exchange APDU with context
+func (sam *CRT571SAM) TransmitContext(ctx context.Context, apdu []byte) ([]byte, error) {
+	if len(apdu) == 0 {
+		return nil, fmt.Errorf("%w: empty APDU", ErrAPDU)
+	}
+	pm := CRT571_PM_SAMCARD_CONTROL_AUTO_APDU
+	if atr := sam.ATR(); atr != nil {
+		switch atr.Protocol() {
+		case 0:
+			pm = CRT571_PM_SAMCARD_CONTROL_TO_APDU
+		case 1:
+			pm = CRT571_PM_SAMCARD_CONTROL_T1_APDU
+		}
+	}
+	return sam.command(ctx, pm, apdu)
+}
+
+// Exchange command APDU, GET RESPONSE on 61xx and Le correction on 6Cxx
+// are handled, data of chained responses is concatenated
+func (sam *CRT571SAM) TransmitAPDU(cmd CRT571CommandAPDU) (*CRT571ResponseAPDU, error) {
+	return sam.TransmitAPDUContext(sam.background(), cmd)
+}
+
+// Exchange command APDU with context
+func (sam *CRT571SAM) TransmitAPDUContext(ctx context.Context, cmd CRT571CommandAPDU) (*CRT571ResponseAPDU, error) {
+	return transmitAPDU(func(apdu []byte) ([]byte, error) { return sam.TransmitContext(ctx, apdu) }, cmd)
+}
+
+// Power down SAM
+func (sam *CRT571SAM) Close() error {
+	return sam.CloseContext(sam.background())
+}
+
+// Power down SAM with context
+func (sam *CRT571SAM) CloseContext(ctx context.Context) error {
+	sam.setATR(nil)
+	_, err := sam.command(ctx, CRT571_PM_SAMCARD_CONTROL_POWER_DOWN, nil)
+	return err
+}
@@ -0,0 +1,61 @@
+package crt571_test
+
+import (
+	"testing"
+
+	"github.com/syntech-pro/crt571"
+	"github.com/syntech-pro/crt571/simulator"
+)
+
+func TestSAMSlotInvalidation(t *testing.T) {
+	var slots []int
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{
+		Initialized: true,
+		SAMAPDU: func(slot int, apdu []byte) []byte {
+			slots = append(slots, slot)
+			return []byte{0x90, 0x00}
+		},
+	})
+	sam, err := service.SAM(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sam.ColdReset(); err != nil {
+		t.Fatalf("ColdReset() error: %v", err)
+	}
+	if slot := service.ActiveSlot(); slot != 1 {
+		t.Fatalf("ActiveSlot() = %d, want 1", slot)
+	}
+
+	// Raw STAND command selects other slot
+	if _, err = service.Command(crt571.CRT571_CM_SAM_CARD_CONTROL, crt571.CRT571_PM_SAMCARD_CONTROL_STAND, []byte{'2'}); err != nil {
+		t.Fatal(err)
+	}
+	if slot := service.ActiveSlot(); slot != 2 {
+		t.Fatalf("ActiveSlot() after raw STAND = %d, want 2", slot)
+	}
+	if _, err = sam.Transmit([]byte{0x00, 0x84, 0x00, 0x00, 0x08}); err != nil {
+		t.Fatalf("Transmit() error: %v", err)
+	}
+
+	// INITIALIZE makes active slot unknown
+	if _, err = service.Initialize(crt571.CRT571InitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if slot := service.ActiveSlot(); slot != 0 {
+		t.Fatalf("ActiveSlot() after INITIALIZE = %d, want 0", slot)
+	}
+	if _, err = service.Command(crt571.CRT571_CM_SAM_CARD_CONTROL, crt571.CRT571_PM_SAMCARD_CONTROL_STAND, []byte{'3'}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sam.Transmit([]byte{0x00, 0x84, 0x00, 0x00, 0x08}); err != nil {
+		t.Fatalf("Transmit() error: %v", err)
+	}
+
+	if len(slots) != 2 || slots[0] != 1 || slots[1] != 1 {
+		t.Errorf("APDUs sent to slots %v, want [1 1]", slots)
+	}
+	if state := dev.State(); state.SAMSlot != 1 {
+		t.Errorf("device SAM slot %d, want 1", state.SAMSlot)
+	}
+}
@@ -0,0 +1,122 @@
+package simulator
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// One direction of in-memory link
+type stream struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+	ready  chan struct{}
+}
+
+func newStream() *stream {
+	return &stream{ready: make(chan struct{}, 1)}
+}
+
+func (s *stream) write(data []byte) (int, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	n, _ := s.buf.Write(data)
+	s.mu.Unlock()
+	s.signal()
+	return n, nil
+}
+
+// Read available data. Wait no more than timeout (0 - wait forever),
+// io.EOF is returned when timeout expires without data.
+func (s *stream) read(data []byte, timeout time.Duration) (int, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		s.mu.Lock()
+		if s.buf.Len() > 0 {
+			n, _ := s.buf.Read(data)
+			s.mu.Unlock()
+			return n, nil
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return 0, io.ErrClosedPipe
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-expired:
+			return 0, io.EOF
+		}
+	}
+}
+
+func (s *stream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *stream) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Host end of in-memory link, implements crt571.CRT571Transport
+type hostLink struct {
+	in      *stream
+	out     *stream
+	mu      sync.Mutex
+	timeout time.Duration
+}
+
+func (l *hostLink) Read(data []byte) (int, error) {
+	l.mu.Lock()
+	timeout := l.timeout
+	l.mu.Unlock()
+	return l.in.read(data, timeout)
+}
+
+func (l *hostLink) Write(data []byte) (int, error) {
+	return l.out.write(data)
+}
+
+func (l *hostLink) Close() error {
+	l.in.close()
+	l.out.close()
+	return nil
+}
+
+func (l *hostLink) SetReadTimeout(timeout time.Duration) error {
+	l.mu.Lock()
+	l.timeout = timeout
+	l.mu.Unlock()
+	return nil
+}
+
+// Device end of in-memory link
+type deviceLink struct {
+	in  *stream
+	out *stream
+}
+
+func (l *deviceLink) Read(data []byte) (int, error) {
+	return l.in.read(data, 0)
+}
+
+func (l *deviceLink) Write(data []byte) (int, error) {
+	return l.out.write(data)
+}
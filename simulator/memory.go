@@ -0,0 +1,233 @@
+package simulator
+
+import (
+	"bytes"
+
+	"github.com/syntech-pro/crt571"
+)
+
+var (
+	DefaultSLE4442PSC = []byte{0xff, 0xff, 0xff}
+	DefaultSLE4442ATR = []byte{0xa2, 0x13, 0x10, 0x91}
+	DefaultSLE4428PSC = []byte{0xff, 0xff}
+	DefaultSLE4428ATR = []byte{0x92, 0x23, 0x10, 0x91}
+)
+
+// SLE4442/4428 memory card: main memory, protection bits, PSC and error counter
+type memoryCard struct {
+	sle4428   bool
+	main      []byte
+	protected []bool
+	psc       []byte
+	attempts  int // Error counter
+	verified  bool
+}
+
+func newMemoryCard(config Config) *memoryCard {
+	card := &memoryCard{sle4428: config.CardICType == "21"}
+	psc, size := DefaultSLE4442PSC, crt571.CRT571_SLE4442_SIZE
+	card.attempts = crt571.CRT571_SLE4442_PSC_ATTEMPTS
+	if card.sle4428 {
+		psc, size = DefaultSLE4428PSC, crt571.CRT571_SLE4428_SIZE
+		card.attempts = crt571.CRT571_SLE4428_PSC_ATTEMPTS
+	}
+	if config.CardPSC != nil {
+		psc = config.CardPSC
+	}
+	card.psc = bytes.Clone(psc)
+	card.main = make([]byte, size)
+	card.protected = make([]bool, size)
+	return card
+}
+
+// SLE4442/4428 card on IC card position
+func (d *Device) memoryCard(pm byte, data []byte) ([]byte, string) {
+	if d.state.Position != PositionIC {
+		d.state.CardPowered = false
+		return nil, "02"
+	}
+	if d.config.CardICType != "20" && d.config.CardICType != "21" {
+		return nil, "61"
+	}
+
+	card := d.memory
+	switch pm {
+	case crt571.CRT571_PM_SLE4442_4428_CARD_CONTROL_RESET:
+		d.state.CardPowered = true
+		card.verified = false
+		if card.sle4428 {
+			return DefaultSLE4428ATR, ""
+		}
+		return DefaultSLE4442ATR, ""
+	case crt571.CRT571_PM_SLE4442_4428_CARD_CONTROL_POWER_DOWN:
+		d.state.CardPowered = false
+		return nil, ""
+	case crt571.CRT571_PM_SLE4442_4428_CARD_CONTROL_CARD_STATUS:
+		if d.state.CardPowered {
+			return []byte("0"), ""
+		}
+		return []byte("1"), ""
+	case crt571.CRT571_PM_SLE4442_4428_CARD_CONTROL_SLE4442_CARD_OPERATE:
+		if card.sle4428 {
+			return nil, "61"
+		}
+	case crt571.CRT571_PM_SLE4442_4428_CARD_CONTROL_SLE4428_CARD_OPERATE:
+		if !card.sle4428 {
+			return nil, "61"
+		}
+	default:
+		return nil, "01"
+	}
+
+	if !d.state.CardPowered {
+		return nil, "65"
+	}
+	if len(data) == 0 {
+		return nil, "04"
+	}
+	if card.sle4428 {
+		return card.operate4428(data[0], data[1:])
+	}
+	return card.operate4442(data[0], data[1:])
+}
+
+func (card *memoryCard) operate4442(sub byte, params []byte) ([]byte, string) {
+	switch sub {
+	case crt571.CRT571_SLE4442_READ_MAIN:
+		addr, n, ok := card.span(params, 1, false)
+		if !ok {
+			return nil, "04"
+		}
+		return bytes.Clone(card.main[addr : addr+n]), ""
+	case crt571.CRT571_SLE4442_READ_PROTECTION:
+		return card.protectionBits(0, crt571.CRT571_SLE4442_PROTECTED_SIZE), ""
+	case crt571.CRT571_SLE4442_READ_SECURITY:
+		res := []byte{byte(1<<card.attempts - 1), 0, 0, 0}
+		if card.verified {
+			copy(res[1:], card.psc)
+		}
+		return res, ""
+	case crt571.CRT571_SLE4442_VERIFY_PSC:
+		return nil, card.verify(params)
+	case crt571.CRT571_SLE4442_CHANGE_PSC:
+		return nil, card.changePSC(params)
+	case crt571.CRT571_SLE4442_WRITE_MAIN:
+		return nil, card.write(params, 1, false)
+	case crt571.CRT571_SLE4442_WRITE_PROTECTION:
+		addr, _, ok := card.span(params, 1, true)
+		if !ok {
+			return nil, "04"
+		}
+		// Byte is protected only if data matches memory
+		for i, b := range params[2:] {
+			a := addr + i
+			if card.verified && a < crt571.CRT571_SLE4442_PROTECTED_SIZE && card.main[a] == b {
+				card.protected[a] = true
+			}
+		}
+		return nil, ""
+	}
+	return nil, "04"
+}
+
+func (card *memoryCard) operate4428(sub byte, params []byte) ([]byte, string) {
+	switch sub {
+	case crt571.CRT571_SLE4428_READ, crt571.CRT571_SLE4428_READ_PROTECTION:
+		addr, n, ok := card.span(params, 2, false)
+		if !ok {
+			return nil, "04"
+		}
+		res := bytes.Clone(card.main[addr : addr+n])
+		if sub == crt571.CRT571_SLE4428_READ_PROTECTION {
+			res = append(res, card.protectionBits(addr, n)...)
+		}
+		return res, ""
+	case crt571.CRT571_SLE4428_READ_ERROR_COUNTER:
+		return []byte{byte(1<<card.attempts - 1)}, ""
+	case crt571.CRT571_SLE4428_VERIFY_PSC:
+		return nil, card.verify(params)
+	case crt571.CRT571_SLE4428_CHANGE_PSC:
+		return nil, card.changePSC(params)
+	case crt571.CRT571_SLE4428_WRITE:
+		return nil, card.write(params, 2, false)
+	case crt571.CRT571_SLE4428_WRITE_PROTECT:
+		return nil, card.write(params, 2, true)
+	}
+	return nil, "04"
+}
+
+// Protection bits of n bytes from addr, bit 0 means protected
+func (card *memoryCard) protectionBits(addr, n int) []byte {
+	res := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		if !card.protected[addr+i] {
+			res[i/8] |= 1 << (i % 8)
+		}
+	}
+	return res
+}
+
+func (card *memoryCard) verify(psc []byte) string {
+	if len(psc) != len(card.psc) {
+		return "04"
+	}
+	if card.attempts == 0 {
+		return ""
+	}
+	if bytes.Equal(psc, card.psc) {
+		card.attempts = crt571.CRT571_SLE4442_PSC_ATTEMPTS
+		if card.sle4428 {
+			card.attempts = crt571.CRT571_SLE4428_PSC_ATTEMPTS
+		}
+		card.verified = true
+	} else {
+		card.attempts--
+	}
+	return ""
+}
+
+func (card *memoryCard) changePSC(psc []byte) string {
+	if len(psc) != len(card.psc) {
+		return "04"
+	}
+	if card.verified {
+		copy(card.psc, psc)
+	}
+	return ""
+}
+
+// Write ADDR LEN DATA, card ignores writes without PSC and writes of protected bytes
+func (card *memoryCard) write(params []byte, addrSize int, protect bool) string {
+	addr, _, ok := card.span(params, addrSize, true)
+	if !ok {
+		return "04"
+	}
+	for i, b := range params[addrSize+1:] {
+		a := addr + i
+		if !card.verified || card.protected[a] {
+			continue
+		}
+		card.main[a] = b
+		card.protected[a] = protect
+	}
+	return ""
+}
+
+// Address and length of ADDR LEN [DATA] parameters with 1 or 2 byte ADDR,
+// 1 byte LEN 00 is 256
+func (card *memoryCard) span(params []byte, addrSize int, write bool) (addr, n int, ok bool) {
+	if len(params) < addrSize+1 {
+		return 0, 0, false
+	}
+	for _, b := range params[:addrSize] {
+		addr = addr<<8 | int(b)
+	}
+	n = int(params[addrSize])
+	if n == 0 {
+		n = 256
+	}
+	if addr+n > len(card.main) || write && len(params) != addrSize+1+n {
+		return 0, 0, false
+	}
+	return addr, n, true
+}
@@ -0,0 +1,615 @@
+// Package simulator is in-process CRT-571 card dispenser simulator.
+// It speaks CRT-571 serial protocol (STX/ADDR/LEN/CMT/CM/PM/DATA/ETX/BCC
+// frames, ACK/NAK/EOT handshake) and models stacker, card position,
+// error card bin and device error codes.
+//
+//	dev := simulator.New(simulator.Config{StackerCards: 50})
+//	service, err := crt571.InitCRT571ServiceWithTransport(config, dev.Transport())
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/syntech-pro/crt571"
+)
+
+const (
+	DefaultFewCards         = 10
+	DefaultErrorBinCapacity = 30
+	DefaultVersion          = "CRT-571 SIMULATOR V1.0"
+	DefaultSerialNumber     = "SIM00000001"
+	DefaultConfig           = "CRT-571"
+	DefaultCardICType       = "10" // T=0 CPU card
+	DefaultCardRFType       = "00" // No RF card
+)
+
+// Answer to reset of simulated CPU card: T=0, historical bytes 14 50
+var DefaultCardATR = []byte{0x3b, 0x02, 0x14, 0x50}
+
+// Answer to reset of simulated SAM: T=0, historical byte 53
+var DefaultSAMATR = []byte{0x3b, 0x01, 0x53}
+
+// Card location inside simulated device
+const (
+	PositionNone = iota // No card in device
+	PositionGate        // Card in output gate
+	PositionHold        // Card on card holding position
+	PositionIC          // Card on IC card position
+	PositionRF          // Card on RF card position
+)
+
+type Config struct {
+	Address          byte                               // Device address
+	StackerCards     int                                // Cards in stacker
+	FewCards         int                                // Stacker reports "few cards" at this level and below
+	ErrorBinCount    int                                // Cards already in error card bin
+	ErrorBinCapacity int                                // Error card bin is full at this count
+	Initialized      bool                               // Device does not require INITIALIZE after power on
+	Version          string                             // Software version information
+	SerialNumber     string                             // Card serial number
+	CardConfig       string                             // Card configuration information
+	CardICType       string                             // Data of IC card type check (CARD_TYPE, PM=0x30)
+	CardRFType       string                             // Data of RF card type check (CARD_TYPE, PM=0x31)
+	CardATR          []byte                             // Answer to reset of CPU card
+	APDU             func(apdu []byte) []byte           // CPU card APDU handler, answers 90 00 if nil
+	SAMATR           []byte                             // Answer to reset of SAMs
+	SAMAPDU          func(slot int, apdu []byte) []byte // SAM APDU handler, answers 90 00 if nil
+	CardPSC          []byte                             // PSC of SLE4442/4428 card, DefaultSLE4442PSC/DefaultSLE4428PSC if nil
+}
+
+// Device state snapshot
+type State struct {
+	Position      int
+	StackerCards  int
+	ErrorBinCount int
+	EntryEnabled  bool
+	Initialized   bool
+	CardPowered   bool // IC card is activated
+	SAMSlot       int  // Selected SAM slot, 0 if none
+	SAMPowered    [crt571.CRT571_SAM_SLOTS + 1]bool
+}
+
+type failure struct {
+	cm   byte
+	code string
+}
+
+type Device struct {
+	mu       sync.Mutex
+	config   Config
+	state    State
+	fails    []failure
+	naks     int // Commands to answer with NAK
+	off      bool
+	corrupts int // Responses to send with wrong BCC
+	memory   *memoryCard
+}
+
+// Create simulated device
+func New(config Config) *Device {
+	if config.FewCards == 0 {
+		config.FewCards = DefaultFewCards
+	}
+	if config.ErrorBinCapacity == 0 {
+		config.ErrorBinCapacity = DefaultErrorBinCapacity
+	}
+	if config.Version == "" {
+		config.Version = DefaultVersion
+	}
+	if config.SerialNumber == "" {
+		config.SerialNumber = DefaultSerialNumber
+	}
+	if config.CardConfig == "" {
+		config.CardConfig = DefaultConfig
+	}
+	if config.CardICType == "" {
+		config.CardICType = DefaultCardICType
+	}
+	if config.CardRFType == "" {
+		config.CardRFType = DefaultCardRFType
+	}
+	if config.CardATR == nil {
+		config.CardATR = DefaultCardATR
+	}
+	if config.SAMATR == nil {
+		config.SAMATR = DefaultSAMATR
+	}
+	return &Device{
+		config: config,
+		memory: newMemoryCard(config),
+		state: State{
+			StackerCards:  config.StackerCards,
+			ErrorBinCount: config.ErrorBinCount,
+			Initialized:   config.Initialized,
+		},
+	}
+}
+
+// Connect to device with in-memory link. Every call makes new link
+// served by its own goroutine, closing transport stops the goroutine.
+func (d *Device) Transport() crt571.CRT571Transport {
+	host := &hostLink{in: newStream(), out: newStream()}
+	go d.Serve(&deviceLink{in: host.out, out: host.in})
+	return host
+}
+
+// Serve CRT-571 protocol on rw until read fails
+func (d *Device) Serve(rw io.ReadWriter) error {
+	var pending, last []byte
+	buf := make([]byte, crt571.CRT571_BUFFER_MAX_LENGTH)
+
+	for {
+		n, err := rw.Read(buf)
+		if err != nil {
+			if err == io.EOF || errors.Is(err, io.ErrClosedPipe) {
+				return nil
+			}
+			return err
+		}
+		pending = append(pending, buf[:n]...)
+
+		for len(pending) > 0 {
+			switch pending[0] {
+			case crt571.CRT571_ACK: // Host received response
+				last = nil
+				pending = pending[1:]
+				continue
+			case crt571.CRT571_NAK: // Host asks to retransmit response
+				pending = pending[1:]
+				if last != nil {
+					if _, err := rw.Write(d.corrupt(last)); err != nil {
+						return err
+					}
+				}
+				continue
+			case crt571.CRT571_EOT: // Clear the line
+				last = nil
+				pending = pending[1:]
+				continue
+			case crt571.CRT571_STX:
+			default: // Garbage between frames
+				pending = pending[1:]
+				continue
+			}
+
+			// STX ADDR LENH LENL ... ETX BCC
+			if len(pending) < 4 {
+				break
+			}
+			size := int(binary.BigEndian.Uint16(pending[2:4])) + 6
+			if size > crt571.CRT571_BUFFER_MAX_LENGTH {
+				pending = pending[1:]
+				continue
+			}
+			if len(pending) < size {
+				break
+			}
+			frame := pending[:size]
+			pending = pending[size:]
+
+			if frame[size-2] != crt571.CRT571_ETX || bcc(frame[:size-1]) != frame[size-1] || size < 9 || frame[4] != crt571.CRT571_CMT {
+				if _, err := rw.Write([]byte{crt571.CRT571_NAK}); err != nil {
+					return err
+				}
+				continue
+			}
+			if frame[1] != d.config.Address || d.poweredOff() {
+				continue
+			}
+
+			if d.takeNAK() {
+				if _, err := rw.Write([]byte{crt571.CRT571_NAK}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if _, err := rw.Write([]byte{crt571.CRT571_ACK}); err != nil {
+				return err
+			}
+			last = d.execute(frame[1], frame[5], frame[6], frame[7:size-2])
+			if _, err := rw.Write(d.corrupt(last)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Current device state
+func (d *Device) State() State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state
+}
+
+// Set number of cards in stacker
+func (d *Device) SetStackerCards(n int) {
+	d.mu.Lock()
+	d.state.StackerCards = n
+	d.mu.Unlock()
+}
+
+// Set number of cards in error card bin
+func (d *Device) SetErrorBinCount(n int) {
+	d.mu.Lock()
+	d.state.ErrorBinCount = n
+	d.mu.Unlock()
+}
+
+// Customer takes card from output gate. Returns false if there is no card in gate.
+func (d *Device) TakeCard() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state.Position != PositionGate {
+		return false
+	}
+	d.state.Position = PositionNone
+	return true
+}
+
+// Customer inserts card into output gate. Returns false if card entry
+// is disabled or device is not empty.
+func (d *Device) InsertCard() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.state.EntryEnabled || d.state.Position != PositionNone {
+		return false
+	}
+	d.state.Position = PositionGate
+	return true
+}
+
+// Next command cm (0 - any command) fails with error code, e.g. "10" (Card Jam).
+// Failures are queued and consumed in order.
+func (d *Device) Fail(cm byte, code string) {
+	d.mu.Lock()
+	d.fails = append(d.fails, failure{cm: cm, code: code})
+	d.mu.Unlock()
+}
+
+// Device stops answering
+func (d *Device) PowerOff() {
+	d.mu.Lock()
+	d.off = true
+	d.mu.Unlock()
+}
+
+// Device answers again and requires INITIALIZE
+func (d *Device) PowerOn() {
+	d.mu.Lock()
+	d.off = false
+	d.state.Initialized = false
+	d.state.EntryEnabled = false
+	d.mu.Unlock()
+}
+
+func (d *Device) poweredOff() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.off
+}
+
+// Answer NAK to next n commands (link errors)
+func (d *Device) NAKCommands(n int) {
+	d.mu.Lock()
+	d.naks = n
+	d.mu.Unlock()
+}
+
+// Send next n responses (including retransmissions) with wrong BCC
+func (d *Device) CorruptResponses(n int) {
+	d.mu.Lock()
+	d.corrupts = n
+	d.mu.Unlock()
+}
+
+func (d *Device) takeNAK() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.naks == 0 {
+		return false
+	}
+	d.naks--
+	return true
+}
+
+func (d *Device) corrupt(frame []byte) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.corrupts == 0 {
+		return frame
+	}
+	d.corrupts--
+	res := append([]byte(nil), frame...)
+	res[len(res)-1] ^= 0xff
+	return res
+}
+
+func (d *Device) execute(addr, cm, pm byte, data []byte) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, f := range d.fails {
+		if f.cm == 0 || f.cm == cm {
+			d.fails = append(d.fails[:i], d.fails[i+1:]...)
+			return d.negative(addr, cm, pm, f.code)
+		}
+	}
+
+	if _, ok := crt571.CRT571Commands[cm]; !ok {
+		return d.negative(addr, cm, pm, "00")
+	}
+	if _, ok := crt571.CRT571PMInfo[cm][pm]; !ok {
+		return d.negative(addr, cm, pm, "01")
+	}
+	if !d.state.Initialized && cm != crt571.CRT571_CM_INITIALIZE && cm != crt571.CRT571_CM_STATUS_REQUEST {
+		return d.negative(addr, cm, pm, "B0")
+	}
+
+	var res []byte
+	code := ""
+
+	switch cm {
+	case crt571.CRT571_CM_INITIALIZE:
+		res, code = d.initialize(pm)
+	case crt571.CRT571_CM_STATUS_REQUEST:
+		if pm == crt571.CRT571_PM_STATUS_SENSOR {
+			res = d.sensors()
+		}
+	case crt571.CRT571_CM_CARD_MOVE:
+		code = d.move(pm)
+	case crt571.CRT571_CM_CARD_ENTRY:
+		d.state.EntryEnabled = pm == crt571.CRT571_PM_CARD_ENTRY_ENABLE
+	case crt571.CRT571_CM_CARD_TYPE:
+		switch {
+		case !d.onPosition():
+			code = "02"
+		case pm == crt571.CRT571_PM_CARD_TYPE_IC:
+			res = []byte(d.config.CardICType)
+		default:
+			res = []byte(d.config.CardRFType)
+		}
+	case crt571.CRT571_CM_CPUCARD_CONTROL:
+		res, code = d.cpuCard(pm, data)
+	case crt571.CRT571_CM_SAM_CARD_CONTROL:
+		res, code = d.sam(pm, data)
+	case crt571.CRT571_CM_SLE4442_4428_CARD_CONTROL:
+		res, code = d.memoryCard(pm, data)
+	case crt571.CRT571_CM_CARD_SERIAL_NUMBER:
+		res = []byte(d.config.SerialNumber)
+	case crt571.CRT571_CM_READ_CARD_CONFIG:
+		res = []byte(d.config.CardConfig)
+	case crt571.CRT571_CM_READ_CRT571_VERSION:
+		res = []byte(d.config.Version)
+	case crt571.CRT571_CM_RECYCLEBIN_COUNTER:
+		if pm == crt571.CRT571_PM_RECYCLEBIN_COUNTER_INITIATE {
+			d.state.ErrorBinCount = 0
+		}
+		res = []byte(fmt.Sprintf("%03d", d.state.ErrorBinCount))
+	default:
+		code = "03"
+	}
+
+	if code != "" {
+		return d.negative(addr, cm, pm, code)
+	}
+	return d.positive(addr, cm, pm, res)
+}
+
+// CPU card on IC card position
+func (d *Device) cpuCard(pm byte, apdu []byte) ([]byte, string) {
+	cpu := d.config.CardICType == "10" || d.config.CardICType == "11"
+	if d.state.Position != PositionIC {
+		d.state.CardPowered = false
+		return nil, "02"
+	}
+
+	switch pm {
+	case crt571.CRT571_PM_CPUCARD_CONTROL_COLD_RESET, crt571.CRT571_PM_CPUCARD_CONTROL_HOT_RESET:
+		if !cpu {
+			return nil, "61"
+		}
+		if pm == crt571.CRT571_PM_CPUCARD_CONTROL_HOT_RESET && !d.state.CardPowered {
+			return nil, "65"
+		}
+		d.state.CardPowered = true
+		return append([]byte{d.config.CardICType[1]}, d.config.CardATR...), ""
+	case crt571.CRT571_PM_CPUCARD_CONTROL_POWER_DOWN:
+		d.state.CardPowered = false
+	case crt571.CRT571_PM_CPUCARD_CONTROL_STATUS_CHECK:
+		if d.state.CardPowered {
+			return []byte("0"), ""
+		}
+		return []byte("1"), ""
+	default: // APDU exchange
+		if !d.state.CardPowered {
+			return nil, "65"
+		}
+		if d.config.APDU == nil {
+			return []byte{0x90, 0x00}, ""
+		}
+		return d.config.APDU(apdu), ""
+	}
+	return nil, ""
+}
+
+// SAM in selected slot
+func (d *Device) sam(pm byte, data []byte) ([]byte, string) {
+	if pm == crt571.CRT571_PM_SAMCARD_CONTROL_STAND {
+		if len(data) != 1 || data[0] < '1' || data[0] > '0'+crt571.CRT571_SAM_SLOTS {
+			return nil, "04"
+		}
+		d.state.SAMSlot = int(data[0] - '0')
+		return nil, ""
+	}
+	slot := d.state.SAMSlot
+	if slot == 0 {
+		return nil, "02"
+	}
+
+	switch pm {
+	case crt571.CRT571_PM_SAMCARD_CONTROL_COLD_RESET, crt571.CRT571_PM_SAMCARD_CONTROL_HOT_RESET:
+		if pm == crt571.CRT571_PM_SAMCARD_CONTROL_HOT_RESET && !d.state.SAMPowered[slot] {
+			return nil, "65"
+		}
+		d.state.SAMPowered[slot] = true
+		return append([]byte{'0'}, d.config.SAMATR...), ""
+	case crt571.CRT571_PM_SAMCARD_CONTROL_POWER_DOWN:
+		d.state.SAMPowered[slot] = false
+	case crt571.CRT571_PM_SAMCARD_CONTROL_STATUS_CHECK:
+		if d.state.SAMPowered[slot] {
+			return []byte("0"), ""
+		}
+		return []byte("1"), ""
+	default: // APDU exchange
+		if !d.state.SAMPowered[slot] {
+			return nil, "65"
+		}
+		if d.config.SAMAPDU == nil {
+			return []byte{0x90, 0x00}, ""
+		}
+		return d.config.SAMAPDU(slot, data), ""
+	}
+	return nil, ""
+}
+
+func (d *Device) initialize(pm byte) ([]byte, string) {
+	d.state.Initialized = true
+	d.state.EntryEnabled = false
+	d.state.CardPowered = false
+
+	if d.state.Position != PositionNone {
+		switch pm {
+		case crt571.CRT571_PM_INITIALIZE_MOVE_CARD, crt571.CRT571_PM_INITIALIZE_MOVE_CARD_RETRACT:
+			d.state.Position = PositionHold
+		case crt571.CRT571_PM_INITIALIZE_CAPTURE_CARD, crt571.CRT571_PM_INITIALIZE_CAPTURE_CARD_RETRACT:
+			if d.binFull() {
+				return nil, "50"
+			}
+			d.state.Position = PositionNone
+			if pm == crt571.CRT571_PM_INITIALIZE_CAPTURE_CARD_RETRACT {
+				d.state.ErrorBinCount++
+			}
+		}
+	}
+	return []byte(d.config.Version), ""
+}
+
+func (d *Device) move(pm byte) string {
+	d.state.CardPowered = false // IC contacts are released
+	if pm == crt571.CRT571_PM_CARD_MOVE_ERROR_BIN {
+		if d.state.Position == PositionNone {
+			return "02"
+		}
+		if d.binFull() {
+			return "50"
+		}
+		d.state.Position = PositionNone
+		d.state.ErrorBinCount++
+		return ""
+	}
+
+	// Feed card from stacker
+	if d.state.Position == PositionNone {
+		if d.state.StackerCards == 0 {
+			return "A0"
+		}
+		d.state.StackerCards--
+	}
+
+	switch pm {
+	case crt571.CRT571_PM_CARD_MOVE_HOLD:
+		d.state.Position = PositionHold
+	case crt571.CRT571_PM_CARD_MOVE_IC_POS:
+		d.state.Position = PositionIC
+	case crt571.CRT571_PM_CARD_MOVE_RF_POS:
+		d.state.Position = PositionRF
+	case crt571.CRT571_PM_CARD_MOVE_GATE:
+		d.state.Position = PositionGate
+	}
+	return ""
+}
+
+// Sensor status: one '0'/'1' byte per sensor
+func (d *Device) sensors() []byte {
+	s := []bool{
+		d.state.Position == PositionGate,          // Gate
+		d.state.Position == PositionHold,          // Card holding position
+		d.state.Position == PositionIC,            // IC card position
+		d.state.Position == PositionRF,            // RF card position
+		false,                                     // Error card bin entrance
+		d.state.StackerCards <= d.config.FewCards, // Stacker pre-empty
+		d.state.StackerCards == 0,                 // Stacker empty
+		d.binFull(),                               // Error card bin full
+	}
+	res := make([]byte, len(s))
+	for i, v := range s {
+		res[i] = '0'
+		if v {
+			res[i] = '1'
+		}
+	}
+	return res
+}
+
+func (d *Device) onPosition() bool {
+	return d.state.Position == PositionHold || d.state.Position == PositionIC || d.state.Position == PositionRF
+}
+
+func (d *Device) binFull() bool {
+	return d.state.ErrorBinCount >= d.config.ErrorBinCapacity
+}
+
+func (d *Device) cardStatus() []byte {
+	st := []byte{crt571.CRT571_ST0_NO_CARD, crt571.CRT571_ST1_ENOUGH_CARDS_IN_BOX, crt571.CRT571_ST2_ERROR_CARD_BIN_NOT_FULL}
+	switch d.state.Position {
+	case PositionGate:
+		st[0] = crt571.CRT571_ST0_ONE_CARD_IN_GATE
+	case PositionHold, PositionIC, PositionRF:
+		st[0] = crt571.CRT571_ST0_ONE_CARD_ON_POSITION
+	}
+	if d.state.StackerCards == 0 {
+		st[1] = crt571.CRT571_ST1_NO_CARD_IN_STACKER
+	} else if d.state.StackerCards <= d.config.FewCards {
+		st[1] = crt571.CRT571_ST1_FEW_CARD_IN_STACKER
+	}
+	if d.binFull() {
+		st[2] = crt571.CRT571_ST2_ERROR_CARD_BIN_FULL
+	}
+	return st
+}
+
+// Positive response: STX ADDR LEN PMT CM PM ST0 ST1 ST2 DATA ETX BCC
+func (d *Device) positive(addr, cm, pm byte, data []byte) []byte {
+	body := append([]byte{crt571.CRT571_PMT, cm, pm}, d.cardStatus()...)
+	return frame(addr, append(body, data...))
+}
+
+// Negative response: STX ADDR LEN EMT CM PM E1 E0 DATA ETX BCC
+func (d *Device) negative(addr, cm, pm byte, code string) []byte {
+	return frame(addr, []byte{crt571.CRT571_EMT2, cm, pm, code[0], code[1]})
+}
+
+func frame(addr byte, body []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(crt571.CRT571_STX)
+	b.WriteByte(addr)
+	binary.Write(&b, binary.BigEndian, uint16(len(body)))
+	b.Write(body)
+	b.WriteByte(crt571.CRT571_ETX)
+	b.WriteByte(bcc(b.Bytes()))
+	return b.Bytes()
+}
+
+func bcc(data []byte) byte {
+	res := byte(0)
+	for _, b := range data {
+		res ^= b
+	}
+	return res
+}
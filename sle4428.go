@@ -0,0 +1,206 @@
+package crt571
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	CRT571_SLE4428_SIZE         = 1024 // Memory size, every byte can be write protected
+	CRT571_SLE4428_MAX_LENGTH   = 255  // Bytes of one read/write command
+	CRT571_SLE4428_PSC_ATTEMPTS = 8    // PSC verification attempts of error counter
+)
+
+// Sub-commands of SLE4428 card operation (CRT571_PM_SLE4442_4428_CARD_CONTROL_SLE4428_CARD_OPERATE),
+// first byte of command data. Address is 2 bytes ADDRH ADDRL.
+const (
+	CRT571_SLE4428_READ               byte = 0x30 // Read: ADDRH ADDRL LEN -> DATA
+	CRT571_SLE4428_READ_PROTECTION    byte = 0x31 // Read with protection bits: ADDRH ADDRL LEN -> DATA BITS, bit 0 means protected
+	CRT571_SLE4428_WRITE              byte = 0x32 // Write: ADDRH ADDRL LEN DATA
+	CRT571_SLE4428_WRITE_PROTECT      byte = 0x33 // Write and protect: ADDRH ADDRL LEN DATA
+	CRT571_SLE4428_VERIFY_PSC         byte = 0x34 // Verify PSC: PSC1 PSC2
+	CRT571_SLE4428_CHANGE_PSC         byte = 0x35 // Change PSC: PSC1 PSC2
+	CRT571_SLE4428_READ_ERROR_COUNTER byte = 0x36 // Read error counter: -> EC
+)
+
+// SLE4428 memory card: 1024 bytes, every byte can be write protected,
+// writes require 2 byte PSC (programmable security code) verification.
+type CRT571SLE4428 struct {
+	cardHandle
+}
+
+// Reset SLE4428 card, returns answer to reset
+func (card *CRT571SLE4428) Reset() ([]byte, error) {
+	return card.ResetContext(card.background())
+}
+
+// Reset SLE4428 card with context
+func (card *CRT571SLE4428) ResetContext(ctx context.Context) ([]byte, error) {
+	return card.sleReset(ctx)
+}
+
+// SLE4428 card status
+func (card *CRT571SLE4428) Status() ([]byte, error) {
+	return card.StatusContext(card.background())
+}
+
+// SLE4428 card status with context
+func (card *CRT571SLE4428) StatusContext(ctx context.Context) ([]byte, error) {
+	return card.sleStatus(ctx)
+}
+
+// Power down SLE4428 card
+func (card *CRT571SLE4428) Close() error {
+	return card.CloseContext(card.background())
+}
+
+// Power down SLE4428 card with context
+func (card *CRT571SLE4428) CloseContext(ctx context.Context) error {
+	return card.slePowerDown(ctx)
+}
+
+func (card *CRT571SLE4428) operate(ctx context.Context, sub byte, params ...byte) ([]byte, error) {
+	return card.sleOperate(ctx, CRT571_PM_SLE4442_4428_CARD_CONTROL_SLE4428_CARD_OPERATE, sub, params...)
+}
+
+// Read n bytes from addr
+func (card *CRT571SLE4428) Read(addr, n int) ([]byte, error) {
+	return card.ReadContext(card.background(), addr, n)
+}
+
+// Read n bytes from addr with context
+func (card *CRT571SLE4428) ReadContext(ctx context.Context, addr, n int) ([]byte, error) {
+	if err := checkSLE4428Range(addr, n); err != nil {
+		return nil, err
+	}
+	data, err := card.operate(ctx, CRT571_SLE4428_READ, byte(addr>>8), byte(addr), byte(n))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != n {
+		return nil, fmt.Errorf("%w: read %d bytes, got %d", ErrProtocol, n, len(data))
+	}
+	return data, nil
+}
+
+// Read n bytes from addr with their protection bits
+func (card *CRT571SLE4428) ReadProtected(addr, n int) (data []byte, protected []bool, err error) {
+	return card.ReadProtectedContext(card.background(), addr, n)
+}
+
+// Read n bytes from addr with their protection bits with context
+func (card *CRT571SLE4428) ReadProtectedContext(ctx context.Context, addr, n int) (data []byte, protected []bool, err error) {
+	if err = checkSLE4428Range(addr, n); err != nil {
+		return nil, nil, err
+	}
+	res, err := card.operate(ctx, CRT571_SLE4428_READ_PROTECTION, byte(addr>>8), byte(addr), byte(n))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(res) != n+(n+7)/8 {
+		return nil, nil, fmt.Errorf("%w: read %d bytes with protection bits, got %d", ErrProtocol, n, len(res))
+	}
+	data, flags := res[:n], res[n:]
+	protected = make([]bool, n)
+	for i := range protected {
+		protected[i] = flags[i/8]&(1<<(i%8)) == 0
+	}
+	return data, protected, nil
+}
+
+// Write data at addr, PSC must be verified
+func (card *CRT571SLE4428) Write(addr int, data []byte) error {
+	return card.WriteContext(card.background(), addr, data)
+}
+
+// Write data at addr with context
+func (card *CRT571SLE4428) WriteContext(ctx context.Context, addr int, data []byte) error {
+	return card.write(ctx, CRT571_SLE4428_WRITE, addr, data)
+}
+
+// Write data at addr and write protect written bytes permanently,
+// PSC must be verified
+func (card *CRT571SLE4428) WriteProtected(addr int, data []byte) error {
+	return card.WriteProtectedContext(card.background(), addr, data)
+}
+
+// Write data at addr and write protect written bytes with context
+func (card *CRT571SLE4428) WriteProtectedContext(ctx context.Context, addr int, data []byte) error {
+	return card.write(ctx, CRT571_SLE4428_WRITE_PROTECT, addr, data)
+}
+
+func (card *CRT571SLE4428) write(ctx context.Context, sub byte, addr int, data []byte) error {
+	if err := checkSLE4428Range(addr, len(data)); err != nil {
+		return err
+	}
+	_, err := card.operate(ctx, sub, append([]byte{byte(addr >> 8), byte(addr), byte(len(data))}, data...)...)
+	return err
+}
+
+// Remaining PSC verification attempts 0-8 (set bits of error counter)
+func (card *CRT571SLE4428) ReadErrorCounter() (int, error) {
+	return card.ReadErrorCounterContext(card.background())
+}
+
+// Remaining PSC verification attempts with context
+func (card *CRT571SLE4428) ReadErrorCounterContext(ctx context.Context) (int, error) {
+	data, err := card.operate(ctx, CRT571_SLE4428_READ_ERROR_COUNTER)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w: empty error counter", ErrProtocol)
+	}
+	return bits.OnesCount8(data[0]), nil
+}
+
+// Verify PSC. Verification is refused with ErrPSCLastAttempt when error
+// counter has one attempt left, use ForceVerifyPSC to spend it.
+func (card *CRT571SLE4428) VerifyPSC(psc [2]byte) error {
+	return card.VerifyPSCContext(card.background(), psc)
+}
+
+// Verify PSC with context
+func (card *CRT571SLE4428) VerifyPSCContext(ctx context.Context, psc [2]byte) error {
+	return card.verifyPSC(ctx, psc, false)
+}
+
+// Verify PSC even on last attempt of error counter. Wrong PSC locks card.
+func (card *CRT571SLE4428) ForceVerifyPSC(psc [2]byte) error {
+	return card.ForceVerifyPSCContext(card.background(), psc)
+}
+
+// Verify PSC even on last attempt of error counter with context
+func (card *CRT571SLE4428) ForceVerifyPSCContext(ctx context.Context, psc [2]byte) error {
+	return card.verifyPSC(ctx, psc, true)
+}
+
+func (card *CRT571SLE4428) verifyPSC(ctx context.Context, psc [2]byte, force bool) error {
+	readCounter := func() (int, error) {
+		return card.ReadErrorCounterContext(ctx)
+	}
+	verify := func() error {
+		_, err := card.operate(ctx, CRT571_SLE4428_VERIFY_PSC, psc[:]...)
+		return err
+	}
+	return card.sleVerifyPSC(readCounter, verify, CRT571_SLE4428_PSC_ATTEMPTS, force)
+}
+
+// Change PSC, current PSC must be verified
+func (card *CRT571SLE4428) ChangePSC(psc [2]byte) error {
+	return card.ChangePSCContext(card.background(), psc)
+}
+
+// Change PSC with context
+func (card *CRT571SLE4428) ChangePSCContext(ctx context.Context, psc [2]byte) error {
+	_, err := card.operate(ctx, CRT571_SLE4428_CHANGE_PSC, psc[:]...)
+	return err
+}
+
+func checkSLE4428Range(addr, n int) error {
+	if n < 1 || n > CRT571_SLE4428_MAX_LENGTH || addr < 0 || addr+n > CRT571_SLE4428_SIZE {
+		return fmt.Errorf("%w: %d bytes at %d", ErrCardAddress, n, addr)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package crt571_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/syntech-pro/crt571"
+	"github.com/syntech-pro/crt571/simulator"
+)
+
+func TestSLE4428ReadProtected(t *testing.T) {
+	card := resetMemoryCard(t, "21").(*crt571.CRT571SLE4428)
+	if err := card.VerifyPSC([2]byte(simulator.DefaultSLE4428PSC)); err != nil {
+		t.Fatalf("VerifyPSC() error: %v", err)
+	}
+
+	if err := card.Write(996, []byte("abcd")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if err := card.WriteProtected(1000, []byte("xyz")); err != nil {
+		t.Fatalf("WriteProtected() error: %v", err)
+	}
+	// Protection bits of 10 bytes span two bytes of response
+	data, protected, err := card.ReadProtected(996, 10)
+	if err != nil {
+		t.Fatalf("ReadProtected() error: %v", err)
+	}
+	want := []bool{false, false, false, false, true, true, true, false, false, false}
+	if string(data) != "abcdxyz\x00\x00\x00" || !slices.Equal(protected, want) {
+		t.Errorf("ReadProtected() = %q %v, want bytes 1000-1002 protected", data, protected)
+	}
+
+	// Card ignores write of protected bytes
+	if err = card.Write(999, []byte("12")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if data, err = card.Read(999, 2); err != nil || string(data) != "1x" {
+		t.Errorf("Read() after write of protected byte = %q, %v, want 1x", data, err)
+	}
+}
+
+func TestSLE4428PSCGuard(t *testing.T) {
+	card := resetMemoryCard(t, "21").(*crt571.CRT571SLE4428)
+	psc := [2]byte(simulator.DefaultSLE4428PSC)
+	wrong := [2]byte{1, 2}
+
+	expectCounter := func(want int) {
+		t.Helper()
+		if attempts, err := card.ReadErrorCounter(); err != nil || attempts != want {
+			t.Fatalf("ReadErrorCounter() = %d, %v, want %d", attempts, err, want)
+		}
+	}
+	expectCounter(crt571.CRT571_SLE4428_PSC_ATTEMPTS)
+
+	for left := crt571.CRT571_SLE4428_PSC_ATTEMPTS - 1; left > 0; left-- {
+		err := card.VerifyPSC(wrong)
+		if !errors.Is(err, crt571.ErrPSCMismatch) || !strings.Contains(err.Error(), fmt.Sprintf("%d attempts left", left)) {
+			t.Fatalf("VerifyPSC() of wrong PSC error: %v, want ErrPSCMismatch with %d attempts left", err, left)
+		}
+	}
+	expectCounter(1)
+
+	if err := card.VerifyPSC(psc); !errors.Is(err, crt571.ErrPSCLastAttempt) {
+		t.Fatalf("VerifyPSC() on last attempt error: %v, want ErrPSCLastAttempt", err)
+	}
+	if err := card.ForceVerifyPSC(psc); err != nil {
+		t.Fatalf("ForceVerifyPSC() on last attempt error: %v", err)
+	}
+	expectCounter(crt571.CRT571_SLE4428_PSC_ATTEMPTS)
+
+	for i := 1; i < crt571.CRT571_SLE4428_PSC_ATTEMPTS; i++ {
+		if err := card.VerifyPSC(wrong); !errors.Is(err, crt571.ErrPSCMismatch) {
+			t.Fatalf("VerifyPSC() of wrong PSC error: %v, want ErrPSCMismatch", err)
+		}
+	}
+	if err := card.ForceVerifyPSC(wrong); !errors.Is(err, crt571.ErrPSCMismatch) {
+		t.Fatalf("ForceVerifyPSC() of wrong PSC error: %v, want ErrPSCMismatch", err)
+	}
+	expectCounter(0)
+	if err := card.ForceVerifyPSC(psc); !errors.Is(err, crt571.ErrPSCLocked) {
+		t.Errorf("ForceVerifyPSC() of locked card error: %v, want ErrPSCLocked", err)
+	}
+}
+
+func TestSLE4428Range(t *testing.T) {
+	card := resetMemoryCard(t, "21").(*crt571.CRT571SLE4428)
+
+	long := make([]byte, crt571.CRT571_SLE4428_MAX_LENGTH+1)
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"Read past end", func() error { _, err := card.Read(1020, 5); return err }()},
+		{"Read over max length", func() error { _, err := card.Read(0, crt571.CRT571_SLE4428_MAX_LENGTH+1); return err }()},
+		{"Read negative address", func() error { _, err := card.Read(-1, 1); return err }()},
+		{"ReadProtected past end", func() error { _, _, err := card.ReadProtected(1023, 2); return err }()},
+		{"Write past end", card.Write(1023, []byte{1, 2})},
+		{"Write over max length", card.Write(0, long)},
+		{"WriteProtected no data", card.WriteProtected(0, nil)},
+	} {
+		if !errors.Is(tc.err, crt571.ErrCardAddress) {
+			t.Errorf("%s error: %v, want ErrCardAddress", tc.name, tc.err)
+		}
+	}
+
+	// Last bytes of memory in one command of max length
+	addr := crt571.CRT571_SLE4428_SIZE - crt571.CRT571_SLE4428_MAX_LENGTH
+	if data, err := card.Read(addr, crt571.CRT571_SLE4428_MAX_LENGTH); err != nil || len(data) != crt571.CRT571_SLE4428_MAX_LENGTH {
+		t.Errorf("Read(%d, %d) = %d bytes, %v", addr, crt571.CRT571_SLE4428_MAX_LENGTH, len(data), err)
+	}
+}
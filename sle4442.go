@@ -0,0 +1,223 @@
+package crt571
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	CRT571_SLE4442_SIZE           = 256 // Main memory size
+	CRT571_SLE4442_PROTECTED_SIZE = 32  // Bytes 0-31 may be write protected
+	CRT571_SLE4442_PSC_ATTEMPTS   = 3   // PSC verification attempts of error counter
+)
+
+// Sub-commands of SLE4442 card operation (CRT571_PM_SLE4442_4428_CARD_CONTROL_SLE4442_CARD_OPERATE),
+// first byte of command data. LEN 00 means 256 bytes.
+const (
+	CRT571_SLE4442_READ_MAIN        byte = 0x30 // Read main memory: ADDR LEN -> DATA
+	CRT571_SLE4442_READ_PROTECTION  byte = 0x31 // Read protection memory: -> 4 bytes
+	CRT571_SLE4442_READ_SECURITY    byte = 0x32 // Read security memory: -> EC PSC1 PSC2 PSC3
+	CRT571_SLE4442_VERIFY_PSC       byte = 0x33 // Verify PSC: PSC1 PSC2 PSC3
+	CRT571_SLE4442_CHANGE_PSC       byte = 0x34 // Change PSC: PSC1 PSC2 PSC3
+	CRT571_SLE4442_WRITE_MAIN       byte = 0x35 // Write main memory: ADDR LEN DATA
+	CRT571_SLE4442_WRITE_PROTECTION byte = 0x36 // Write and protect: ADDR LEN DATA, DATA must match main memory
+)
+
+var (
+	ErrCardAddress    = errors.New("crt571: memory card address out of range")
+	ErrPSCMismatch    = errors.New("crt571: PSC verification failed")
+	ErrPSCLocked      = errors.New("crt571: PSC error counter exhausted, card is locked")
+	ErrPSCLastAttempt = errors.New("crt571: PSC error counter at last attempt")
+)
+
+// SLE4442 memory card: 256 bytes main memory, bytes 0-31 can be write
+// protected, writes require PSC (programmable security code) verification.
+type CRT571SLE4442 struct {
+	cardHandle
+}
+
+// SLE4442 protection memory, one bit per byte 0-31, bit 0 means protected
+type CRT571SLE4442Protection [4]byte
+
+// Byte at addr is write protected
+func (protection CRT571SLE4442Protection) Protected(addr int) bool {
+	if addr < 0 || addr >= CRT571_SLE4442_PROTECTED_SIZE {
+		return false
+	}
+	return protection[addr/8]&(1<<(addr%8)) == 0
+}
+
+// Reset SLE4442 card, returns answer to reset
+func (card *CRT571SLE4442) Reset() ([]byte, error) {
+	return card.ResetContext(card.background())
+}
+
+// Reset SLE4442 card with context
+func (card *CRT571SLE4442) ResetContext(ctx context.Context) ([]byte, error) {
+	return card.sleReset(ctx)
+}
+
+// SLE4442 card status
+func (card *CRT571SLE4442) Status() ([]byte, error) {
+	return card.StatusContext(card.background())
+}
+
+// SLE4442 card status with context
+func (card *CRT571SLE4442) StatusContext(ctx context.Context) ([]byte, error) {
+	return card.sleStatus(ctx)
+}
+
+// Power down SLE4442 card
+func (card *CRT571SLE4442) Close() error {
+	return card.CloseContext(card.background())
+}
+
+// Power down SLE4442 card with context
+func (card *CRT571SLE4442) CloseContext(ctx context.Context) error {
+	return card.slePowerDown(ctx)
+}
+
+func (card *CRT571SLE4442) operate(ctx context.Context, sub byte, params ...byte) ([]byte, error) {
+	return card.sleOperate(ctx, CRT571_PM_SLE4442_4428_CARD_CONTROL_SLE4442_CARD_OPERATE, sub, params...)
+}
+
+// Read n bytes of main memory from addr
+func (card *CRT571SLE4442) Read(addr, n int) ([]byte, error) {
+	return card.ReadContext(card.background(), addr, n)
+}
+
+// Read n bytes of main memory from addr with context
+func (card *CRT571SLE4442) ReadContext(ctx context.Context, addr, n int) ([]byte, error) {
+	if err := checkSLE4442Range(addr, n); err != nil {
+		return nil, err
+	}
+	data, err := card.operate(ctx, CRT571_SLE4442_READ_MAIN, byte(addr), byte(n))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != n {
+		return nil, fmt.Errorf("%w: read %d bytes, got %d", ErrProtocol, n, len(data))
+	}
+	return data, nil
+}
+
+// Write data to main memory at addr, PSC must be verified
+func (card *CRT571SLE4442) Write(addr int, data []byte) error {
+	return card.WriteContext(card.background(), addr, data)
+}
+
+// Write data to main memory at addr with context
+func (card *CRT571SLE4442) WriteContext(ctx context.Context, addr int, data []byte) error {
+	if err := checkSLE4442Range(addr, len(data)); err != nil {
+		return err
+	}
+	_, err := card.operate(ctx, CRT571_SLE4442_WRITE_MAIN, append([]byte{byte(addr), byte(len(data))}, data...)...)
+	return err
+}
+
+// Read protection memory
+func (card *CRT571SLE4442) ReadProtectionMemory() (CRT571SLE4442Protection, error) {
+	return card.ReadProtectionMemoryContext(card.background())
+}
+
+// Read protection memory with context
+func (card *CRT571SLE4442) ReadProtectionMemoryContext(ctx context.Context) (CRT571SLE4442Protection, error) {
+	var protection CRT571SLE4442Protection
+	data, err := card.operate(ctx, CRT571_SLE4442_READ_PROTECTION)
+	if err != nil {
+		return protection, err
+	}
+	if len(data) != len(protection) {
+		return protection, fmt.Errorf("%w: protection memory [% x]", ErrProtocol, data)
+	}
+	copy(protection[:], data)
+	return protection, nil
+}
+
+// Write protect byte at addr 0-31 permanently, its current value is kept.
+// PSC must be verified.
+func (card *CRT571SLE4442) WriteProtect(addr int) error {
+	return card.WriteProtectContext(card.background(), addr)
+}
+
+// Write protect byte at addr 0-31 with context
+func (card *CRT571SLE4442) WriteProtectContext(ctx context.Context, addr int) error {
+	if addr < 0 || addr >= CRT571_SLE4442_PROTECTED_SIZE {
+		return fmt.Errorf("%w: protect address %d", ErrCardAddress, addr)
+	}
+	data, err := card.ReadContext(ctx, addr, 1)
+	if err != nil {
+		return err
+	}
+	_, err = card.operate(ctx, CRT571_SLE4442_WRITE_PROTECTION, byte(addr), 1, data[0])
+	return err
+}
+
+// Remaining PSC verification attempts 0-3 (set bits of error counter)
+func (card *CRT571SLE4442) ReadErrorCounter() (int, error) {
+	return card.ReadErrorCounterContext(card.background())
+}
+
+// Remaining PSC verification attempts with context
+func (card *CRT571SLE4442) ReadErrorCounterContext(ctx context.Context) (int, error) {
+	data, err := card.operate(ctx, CRT571_SLE4442_READ_SECURITY)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w: empty security memory", ErrProtocol)
+	}
+	return bits.OnesCount8(data[0] & 0x07), nil
+}
+
+// Verify PSC. Verification is refused with ErrPSCLastAttempt when error
+// counter has one attempt left, use ForceVerifyPSC to spend it.
+func (card *CRT571SLE4442) VerifyPSC(psc [3]byte) error {
+	return card.VerifyPSCContext(card.background(), psc)
+}
+
+// Verify PSC with context
+func (card *CRT571SLE4442) VerifyPSCContext(ctx context.Context, psc [3]byte) error {
+	return card.verifyPSC(ctx, psc, false)
+}
+
+// Verify PSC even on last attempt of error counter. Wrong PSC locks card.
+func (card *CRT571SLE4442) ForceVerifyPSC(psc [3]byte) error {
+	return card.ForceVerifyPSCContext(card.background(), psc)
+}
+
+// Verify PSC even on last attempt of error counter with context
+func (card *CRT571SLE4442) ForceVerifyPSCContext(ctx context.Context, psc [3]byte) error {
+	return card.verifyPSC(ctx, psc, true)
+}
+
+func (card *CRT571SLE4442) verifyPSC(ctx context.Context, psc [3]byte, force bool) error {
+	readCounter := func() (int, error) {
+		return card.ReadErrorCounterContext(ctx)
+	}
+	verify := func() error {
+		_, err := card.operate(ctx, CRT571_SLE4442_VERIFY_PSC, psc[:]...)
+		return err
+	}
+	return card.sleVerifyPSC(readCounter, verify, CRT571_SLE4442_PSC_ATTEMPTS, force)
+}
+
+// Change PSC, current PSC must be verified
+func (card *CRT571SLE4442) ChangePSC(psc [3]byte) error {
+	return card.ChangePSCContext(card.background(), psc)
+}
+
+// Change PSC with context
+func (card *CRT571SLE4442) ChangePSCContext(ctx context.Context, psc [3]byte) error {
+	_, err := card.operate(ctx, CRT571_SLE4442_CHANGE_PSC, psc[:]...)
+	return err
+}
+
+func checkSLE4442Range(addr, n int) error {
+	if n < 1 || addr < 0 || addr+n > CRT571_SLE4442_SIZE {
+		return fmt.Errorf("%w: %d bytes at %d", ErrCardAddress, n, addr)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package crt571_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/syntech-pro/crt571"
+	"github.com/syntech-pro/crt571/simulator"
+)
+
+// Memory card of IC card type cardType on IC position, reset
+func resetMemoryCard(t *testing.T, cardType string) crt571.CRT571Card {
+	t.Helper()
+	service, _ := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true, CardICType: cardType})
+	if _, err := service.MoveTo(crt571.CRT571_POSITION_IC); err != nil {
+		t.Fatal(err)
+	}
+	card, err := service.DetectCard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, ok := card.(interface{ Reset() ([]byte, error) })
+	if !ok {
+		t.Fatalf("DetectCard() = %T, want memory card", card)
+	}
+	if _, err = reset.Reset(); err != nil {
+		t.Fatalf("Reset() error: %v", err)
+	}
+	return card
+}
+
+func TestSLE4442ReadWrite(t *testing.T) {
+	card := resetMemoryCard(t, "20").(*crt571.CRT571SLE4442)
+	psc := [3]byte(simulator.DefaultSLE4442PSC)
+
+	if err := card.VerifyPSC(psc); err != nil {
+		t.Fatalf("VerifyPSC() error: %v", err)
+	}
+	if err := card.Write(10, []byte("abc")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if data, err := card.Read(10, 3); err != nil || string(data) != "abc" {
+		t.Fatalf("Read() = %q, %v, want abc", data, err)
+	}
+	if data, err := card.Read(0, crt571.CRT571_SLE4442_SIZE); err != nil || len(data) != crt571.CRT571_SLE4442_SIZE {
+		t.Fatalf("Read() of whole memory = %d bytes, %v", len(data), err)
+	}
+
+	if err := card.WriteProtect(10); err != nil {
+		t.Fatalf("WriteProtect() error: %v", err)
+	}
+	protection, err := card.ReadProtectionMemory()
+	if err != nil {
+		t.Fatalf("ReadProtectionMemory() error: %v", err)
+	}
+	if !protection.Protected(10) || protection.Protected(11) {
+		t.Errorf("ReadProtectionMemory() = [% x], want byte 10 protected only", protection)
+	}
+	// Card ignores write of protected byte
+	if err = card.Write(10, []byte("xy")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if data, err := card.Read(10, 3); err != nil || string(data) != "ayc" {
+		t.Errorf("Read() after write of protected byte = %q, %v, want ayc", data, err)
+	}
+}
+
+func TestSLE4442PSCGuard(t *testing.T) {
+	card := resetMemoryCard(t, "20").(*crt571.CRT571SLE4442)
+	psc := [3]byte(simulator.DefaultSLE4442PSC)
+	wrong := [3]byte{1, 2, 3}
+
+	expectCounter := func(want int) {
+		t.Helper()
+		if attempts, err := card.ReadErrorCounter(); err != nil || attempts != want {
+			t.Fatalf("ReadErrorCounter() = %d, %v, want %d", attempts, err, want)
+		}
+	}
+	expectCounter(crt571.CRT571_SLE4442_PSC_ATTEMPTS)
+
+	for _, left := range []string{"2 attempts left", "1 attempts left"} {
+		err := card.VerifyPSC(wrong)
+		if !errors.Is(err, crt571.ErrPSCMismatch) || !strings.Contains(err.Error(), left) {
+			t.Fatalf("VerifyPSC() of wrong PSC error: %v, want ErrPSCMismatch with %s", err, left)
+		}
+	}
+	expectCounter(1)
+
+	// Last attempt is not spent without force, even by right PSC
+	if err := card.VerifyPSC(psc); !errors.Is(err, crt571.ErrPSCLastAttempt) {
+		t.Fatalf("VerifyPSC() on last attempt error: %v, want ErrPSCLastAttempt", err)
+	}
+	expectCounter(1)
+	if err := card.ForceVerifyPSC(psc); err != nil {
+		t.Fatalf("ForceVerifyPSC() on last attempt error: %v", err)
+	}
+	expectCounter(crt571.CRT571_SLE4442_PSC_ATTEMPTS)
+
+	// Wrong PSC on forced last attempt locks card
+	for i := 0; i < 2; i++ {
+		if err := card.VerifyPSC(wrong); !errors.Is(err, crt571.ErrPSCMismatch) {
+			t.Fatalf("VerifyPSC() of wrong PSC error: %v, want ErrPSCMismatch", err)
+		}
+	}
+	if err := card.ForceVerifyPSC(wrong); !errors.Is(err, crt571.ErrPSCMismatch) || !strings.Contains(err.Error(), "0 attempts left") {
+		t.Fatalf("ForceVerifyPSC() of wrong PSC error: %v, want ErrPSCMismatch with 0 attempts left", err)
+	}
+	expectCounter(0)
+	if err := card.VerifyPSC(psc); !errors.Is(err, crt571.ErrPSCLocked) {
+		t.Errorf("VerifyPSC() of locked card error: %v, want ErrPSCLocked", err)
+	}
+	if err := card.ForceVerifyPSC(psc); !errors.Is(err, crt571.ErrPSCLocked) {
+		t.Errorf("ForceVerifyPSC() of locked card error: %v, want ErrPSCLocked", err)
+	}
+}
+
+func TestSLE4442Range(t *testing.T) {
+	card := resetMemoryCard(t, "20").(*crt571.CRT571SLE4442)
+	if err := card.VerifyPSC([3]byte(simulator.DefaultSLE4442PSC)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"Read past end", func() error { _, err := card.Read(250, 7); return err }()},
+		{"Read negative address", func() error { _, err := card.Read(-1, 1); return err }()},
+		{"Read zero bytes", func() error { _, err := card.Read(0, 0); return err }()},
+		{"Write past end", card.Write(255, []byte{1, 2})},
+		{"Write no data", card.Write(0, nil)},
+		{"WriteProtect unprotectable byte", card.WriteProtect(crt571.CRT571_SLE4442_PROTECTED_SIZE)},
+		{"WriteProtect negative address", card.WriteProtect(-1)},
+	} {
+		if !errors.Is(tc.err, crt571.ErrCardAddress) {
+			t.Errorf("%s error: %v, want ErrCardAddress", tc.name, tc.err)
+		}
+	}
+
+	if data, err := card.Read(255, 1); err != nil || !bytes.Equal(data, []byte{0}) {
+		t.Errorf("Read() after refused write = [% x], %v", data, err)
+	}
+}
@@ -0,0 +1,189 @@
+package crt571
+
+import (
+	"context"
+	"fmt"
+)
+
+// Card position from ST0
+type CRT571CardPosition int
+
+const (
+	CRT571_CARD_UNKNOWN     CRT571CardPosition = iota // Unexpected ST0
+	CRT571_CARD_NONE                                  // No card in CRT-571
+	CRT571_CARD_IN_GATE                               // One card in gate
+	CRT571_CARD_ON_POSITION                           // One card on RF/IC card position
+)
+
+// Stacker level from ST1
+type CRT571StackerLevel int
+
+const (
+	CRT571_STACKER_UNKNOWN CRT571StackerLevel = iota // Unexpected ST1
+	CRT571_STACKER_EMPTY                             // No card in stacker
+	CRT571_STACKER_FEW                               // Few cards in stacker
+	CRT571_STACKER_ENOUGH                            // Enough cards in card box
+)
+
+// Error card bin state from ST2
+type CRT571ErrorBinState int
+
+const (
+	CRT571_ERROR_BIN_UNKNOWN  CRT571ErrorBinState = iota // Unexpected ST2
+	CRT571_ERROR_BIN_NOT_FULL                            // Error card bin not full
+	CRT571_ERROR_BIN_FULL                                // Error card bin full
+)
+
+// Parsed card status ST0, ST1, ST2
+type CRT571DeviceStatus struct {
+	Card     CRT571CardPosition
+	Stacker  CRT571StackerLevel
+	ErrorBin CRT571ErrorBinState
+	Raw      []byte // ST0 ST1 ST2
+}
+
+func (position CRT571CardPosition) String() string {
+	switch position {
+	case CRT571_CARD_NONE:
+		return CRT571CardStatus["ST0"][CRT571_ST0_NO_CARD]
+	case CRT571_CARD_IN_GATE:
+		return CRT571CardStatus["ST0"][CRT571_ST0_ONE_CARD_IN_GATE]
+	case CRT571_CARD_ON_POSITION:
+		return CRT571CardStatus["ST0"][CRT571_ST0_ONE_CARD_ON_POSITION]
+	}
+	return "Unknown card position"
+}
+
+func (level CRT571StackerLevel) String() string {
+	switch level {
+	case CRT571_STACKER_EMPTY:
+		return CRT571CardStatus["ST1"][CRT571_ST1_NO_CARD_IN_STACKER]
+	case CRT571_STACKER_FEW:
+		return CRT571CardStatus["ST1"][CRT571_ST1_FEW_CARD_IN_STACKER]
+	case CRT571_STACKER_ENOUGH:
+		return CRT571CardStatus["ST1"][CRT571_ST1_ENOUGH_CARDS_IN_BOX]
+	}
+	return "Unknown stacker level"
+}
+
+func (state CRT571ErrorBinState) String() string {
+	switch state {
+	case CRT571_ERROR_BIN_NOT_FULL:
+		return CRT571CardStatus["ST2"][CRT571_ST2_ERROR_CARD_BIN_NOT_FULL]
+	case CRT571_ERROR_BIN_FULL:
+		return CRT571CardStatus["ST2"][CRT571_ST2_ERROR_CARD_BIN_FULL]
+	}
+	return "Unknown error card bin state"
+}
+
+func (status CRT571DeviceStatus) String() string {
+	return fmt.Sprintf("card:'%s', stacker:'%s', error bin:'%s'", status.Card, status.Stacker, status.ErrorBin)
+}
+
+// Parse card status ST0 ST1 ST2
+func parseDeviceStatus(st []byte) CRT571DeviceStatus {
+	status := CRT571DeviceStatus{Raw: st}
+	if len(st) != 3 {
+		return status
+	}
+
+	switch st[0] {
+	case CRT571_ST0_NO_CARD:
+		status.Card = CRT571_CARD_NONE
+	case CRT571_ST0_ONE_CARD_IN_GATE:
+		status.Card = CRT571_CARD_IN_GATE
+	case CRT571_ST0_ONE_CARD_ON_POSITION:
+		status.Card = CRT571_CARD_ON_POSITION
+	}
+
+	switch st[1] {
+	case CRT571_ST1_NO_CARD_IN_STACKER:
+		status.Stacker = CRT571_STACKER_EMPTY
+	case CRT571_ST1_FEW_CARD_IN_STACKER:
+		status.Stacker = CRT571_STACKER_FEW
+	case CRT571_ST1_ENOUGH_CARDS_IN_BOX:
+		status.Stacker = CRT571_STACKER_ENOUGH
+	}
+
+	switch st[2] {
+	case CRT571_ST2_ERROR_CARD_BIN_NOT_FULL:
+		status.ErrorBin = CRT571_ERROR_BIN_NOT_FULL
+	case CRT571_ST2_ERROR_CARD_BIN_FULL:
+		status.ErrorBin = CRT571_ERROR_BIN_FULL
+	}
+
+	return status
+}
+
+// Parsed card status of positive response
+func (response *CRT571Response) DeviceStatus() CRT571DeviceStatus {
+	return parseDeviceStatus(response.CardStatus)
+}
+
+// Sensor status (STATUS_REQUEST, PM=CRT571_PM_STATUS_SENSOR).
+// Device reports one byte per sensor in field order, 0x31 - card detected (sensor blocked).
+type CRT571SensorStatus struct {
+	Gate            bool // Output gate
+	Hold            bool // Card holding position
+	ICPosition      bool // IC card position
+	RFPosition      bool // RF card position
+	ErrorBinEntry   bool // Error card bin entrance
+	StackerPreEmpty bool // Stacker pre-empty (few cards)
+	StackerEmpty    bool // Stacker empty
+	ErrorBinFull    bool // Error card bin full
+	Raw             []byte
+}
+
+func (sensors CRT571SensorStatus) String() string {
+	return fmt.Sprintf("gate:%t hold:%t ic:%t rf:%t bin entry:%t stacker pre-empty:%t stacker empty:%t bin full:%t",
+		sensors.Gate, sensors.Hold, sensors.ICPosition, sensors.RFPosition, sensors.ErrorBinEntry, sensors.StackerPreEmpty, sensors.StackerEmpty, sensors.ErrorBinFull)
+}
+
+// Parse sensor status data
+func parseSensorStatus(data []byte) CRT571SensorStatus {
+	sensors := CRT571SensorStatus{Raw: data}
+	fields := []*bool{
+		&sensors.Gate,
+		&sensors.Hold,
+		&sensors.ICPosition,
+		&sensors.RFPosition,
+		&sensors.ErrorBinEntry,
+		&sensors.StackerPreEmpty,
+		&sensors.StackerEmpty,
+		&sensors.ErrorBinFull,
+	}
+	for i, field := range fields {
+		if i < len(data) {
+			*field = data[i] == '1'
+		}
+	}
+	return sensors
+}
+
+// Request CRT-571 status
+func (service *CRT571Service) Status() (CRT571DeviceStatus, error) {
+	return service.StatusContext(context.Background())
+}
+
+// Request CRT-571 status with context
+func (service *CRT571Service) StatusContext(ctx context.Context) (CRT571DeviceStatus, error) {
+	res, err := service.CommandContext(ctx, CRT571_CM_STATUS_REQUEST, CRT571_PM_STATUS_DEVICE, nil)
+	if err != nil {
+		return CRT571DeviceStatus{}, err
+	}
+	return res.DeviceStatus(), nil
+}
+
+// Request sensor status
+func (service *CRT571Service) SensorStatus() (CRT571SensorStatus, error) {
+	return service.SensorStatusContext(context.Background())
+}
+
+// Request sensor status with context
+func (service *CRT571Service) SensorStatusContext(ctx context.Context) (CRT571SensorStatus, error) {
+	res, err := service.CommandContext(ctx, CRT571_CM_STATUS_REQUEST, CRT571_PM_STATUS_SENSOR, nil)
+	if err != nil {
+		return CRT571SensorStatus{}, err
+	}
+	return parseSensorStatus(res.Data), nil
+}
@@ -0,0 +1,92 @@
+package crt571
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	rs232 "github.com/syntech-pro/go-rs232"
+	//rs232 "../go-rs232"
+)
+
+// CRT571Transport is a byte stream to CRT-571 device.
+// Read must return io.EOF when read timeout expires and no data was received,
+// this is how readFrame() detects idle line and checks context.
+type CRT571Transport interface {
+	io.ReadWriteCloser
+	SetReadTimeout(timeout time.Duration) error
+}
+
+// Serial port transport (go-rs232)
+type serialTransport struct {
+	port *rs232.SerialPort
+}
+
+// Open serial port transport 8N1
+func OpenSerialTransport(path string, baudRate int) (CRT571Transport, error) {
+	port, err := rs232.OpenPort(path, baudRate, rs232.S_8N1X)
+	if err != nil {
+		return nil, err
+	}
+	return &serialTransport{port: port}, nil
+}
+
+func (t *serialTransport) Read(buf []byte) (int, error) {
+	return t.port.Read(buf)
+}
+
+func (t *serialTransport) Write(buf []byte) (int, error) {
+	return t.port.Write(buf)
+}
+
+func (t *serialTransport) Close() error {
+	return t.port.Close()
+}
+
+func (t *serialTransport) SetReadTimeout(timeout time.Duration) error {
+	t.port.SetInputAttr(0, timeout)
+	return nil
+}
+
+// net.Conn transport (TCP serial servers, net.Pipe)
+type connTransport struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+// Make transport from net.Conn. Read timeout is applied as read deadline
+// before every Read and the deadline error is reported as io.EOF.
+func NewConnTransport(conn net.Conn) CRT571Transport {
+	return &connTransport{conn: conn}
+}
+
+func (t *connTransport) Read(buf []byte) (int, error) {
+	if t.timeout > 0 {
+		if err := t.conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := t.conn.Read(buf)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		if n > 0 {
+			return n, nil
+		}
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (t *connTransport) Write(buf []byte) (int, error) {
+	return t.conn.Write(buf)
+}
+
+func (t *connTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *connTransport) SetReadTimeout(timeout time.Duration) error {
+	t.timeout = timeout
+	return nil
+}
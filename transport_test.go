@@ -0,0 +1,199 @@
+package crt571
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Response frame: STX ADDR LENH LENL body ETX BCC
+func testFrame(addr byte, body ...byte) []byte {
+	frame := []byte{CRT571_STX, addr}
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(body)))
+	frame = append(frame, body...)
+	frame = append(frame, CRT571_ETX)
+	return append(frame, bccCalc(frame))
+}
+
+func TestConnTransportReadTimeout(t *testing.T) {
+	host, dev := net.Pipe()
+	defer dev.Close()
+	transport := NewConnTransport(host)
+	defer transport.Close()
+
+	if err := transport.SetReadTimeout(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	start := time.Now()
+	n, err := transport.Read(buf)
+	if n != 0 || err != io.EOF {
+		t.Fatalf("Read() = %d, %v, want 0, io.EOF", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Read() returned after %s", elapsed)
+	}
+
+	// Data received after timeout is read normally
+	go dev.Write([]byte{CRT571_ACK})
+	n, err = transport.Read(buf)
+	if err != nil || n != 1 || buf[0] != CRT571_ACK {
+		t.Fatalf("Read() = %d [% x], %v, want ACK", n, buf[:n], err)
+	}
+}
+
+func TestConnTransportRequest(t *testing.T) {
+	host, dev := net.Pipe()
+	defer dev.Close()
+	service, err := InitCRT571ServiceWithTransport(CRT571Config{Address: 1, ReadTimeout: 10}, NewConnTransport(host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	command := testFrame(1, CRT571_CMT, CRT571_CM_STATUS_REQUEST, CRT571_PM_STATUS_DEVICE)
+	response := testFrame(1, CRT571_PMT, CRT571_CM_STATUS_REQUEST, CRT571_PM_STATUS_DEVICE,
+		CRT571_ST0_NO_CARD, CRT571_ST1_ENOUGH_CARDS_IN_BOX, CRT571_ST2_ERROR_CARD_BIN_NOT_FULL)
+
+	received := make(chan []byte, 2)
+	go func() {
+		buf := make([]byte, CRT571_BUFFER_MAX_LENGTH)
+		n, err := dev.Read(buf)
+		if err != nil {
+			return
+		}
+		received <- append([]byte(nil), buf[:n]...)
+		dev.Write([]byte{CRT571_ACK})
+		dev.Write(response)
+		n, err = dev.Read(buf)
+		if err != nil {
+			return
+		}
+		received <- append([]byte(nil), buf[:n]...)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := service.request(ctx, CRT571_CM_STATUS_REQUEST, CRT571_PM_STATUS_DEVICE, nil)
+	if err != nil {
+		t.Fatalf("request() error: %v", err)
+	}
+	if got := <-received; !bytes.Equal(got, command) {
+		t.Errorf("device received [% x], want [% x]", got, command)
+	}
+	if got := <-received; !bytes.Equal(got, []byte{CRT571_ACK}) {
+		t.Errorf("device received [% x] after response, want ACK", got)
+	}
+	if res.Type != CRT571_PMT || res.DeviceStatus().Card != CRT571_CARD_NONE || res.DeviceStatus().Stacker != CRT571_STACKER_ENOUGH {
+		t.Errorf("request() = %s", res)
+	}
+}
+
+// Scripted device on conn: every command is ACKed and answered with
+// response frame of body returned by respond
+func testResponder(conn net.Conn, respond func(cm, pm byte, data []byte) []byte) {
+	defer conn.Close()
+	var pending []byte
+	buf := make([]byte, CRT571_BUFFER_MAX_LENGTH)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		pending = append(pending, buf[:n]...)
+		for {
+			for len(pending) > 0 && pending[0] != CRT571_STX {
+				pending = pending[1:] // ACK, EOT
+			}
+			if len(pending) < 4 {
+				break
+			}
+			size := int(binary.BigEndian.Uint16(pending[2:4])) + 6
+			if len(pending) < size {
+				break
+			}
+			cm, pm, data := pending[5], pending[6], pending[7:size-2]
+			pending = pending[size:]
+
+			if _, err = conn.Write([]byte{CRT571_ACK}); err != nil {
+				return
+			}
+			if _, err = conn.Write(testFrame(0, respond(cm, pm, data)...)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Positive response body with card status
+func testPositive(cm, pm byte, st0 byte, data ...byte) []byte {
+	body := []byte{CRT571_PMT, cm, pm, st0, CRT571_ST1_ENOUGH_CARDS_IN_BOX, CRT571_ST2_ERROR_CARD_BIN_NOT_FULL}
+	return append(body, data...)
+}
+
+// Service connected to scripted device over net.Pipe
+func newTestService(t *testing.T, respond func(cm, pm byte, data []byte) []byte) *CRT571Service {
+	t.Helper()
+	host, dev := net.Pipe()
+	go testResponder(dev, respond)
+	service, err := InitCRT571ServiceWithTransport(CRT571Config{ReadTimeout: 10}, NewConnTransport(host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Close() })
+	return &service
+}
+
+func TestClearLineDiscardsLateResponse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("TCP loopback is not available: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		// First response arrives after host timeout, while line is being cleared
+		late := true
+		testResponder(conn, func(cm, pm byte, data []byte) []byte {
+			if late {
+				late = false
+				time.Sleep(150 * time.Millisecond)
+			}
+			return testPositive(cm, pm, CRT571_ST0_NO_CARD)
+		})
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := CRT571Config{
+		ReadTimeout:     100,
+		CommandTimeouts: map[byte]time.Duration{CRT571_CM_STATUS_REQUEST: 30 * time.Millisecond},
+	}
+	service, err := InitCRT571ServiceWithTransport(config, NewConnTransport(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	if _, err = service.Status(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Status() error: %v, want context.DeadlineExceeded", err)
+	}
+	// Late response is discarded, next command gets its own ACK and response
+	res, err := service.Command(CRT571_CM_READ_CRT571_VERSION, CRT571_PM_READ_CRT571_VERSION, nil)
+	if err != nil {
+		t.Fatalf("Command() after timeout error: %v", err)
+	}
+	if res.Type != CRT571_PMT {
+		t.Errorf("Command() = %s", res)
+	}
+}
@@ -0,0 +1,146 @@
+package crt571
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Status watcher event type
+type CRT571EventType int
+
+const (
+	CRT571_EVENT_CARD_PRESENTED_AT_GATE CRT571EventType = iota // Card appeared in gate
+	CRT571_EVENT_CARD_REMOVED                                  // Card was taken from gate (not sent when card is captured from gate)
+	CRT571_EVENT_STACKER_LOW                                   // Few cards in stacker
+	CRT571_EVENT_STACKER_EMPTY                                 // No card in stacker
+	CRT571_EVENT_ERROR_BIN_FULL                                // Error card bin full
+	CRT571_EVENT_DEVICE_OFFLINE                                // Status request failed
+	CRT571_EVENT_DEVICE_ONLINE                                 // Device answers again after offline
+)
+
+func (t CRT571EventType) String() string {
+	switch t {
+	case CRT571_EVENT_CARD_PRESENTED_AT_GATE:
+		return "card presented at gate"
+	case CRT571_EVENT_CARD_REMOVED:
+		return "card removed"
+	case CRT571_EVENT_STACKER_LOW:
+		return "stacker low"
+	case CRT571_EVENT_STACKER_EMPTY:
+		return "stacker empty"
+	case CRT571_EVENT_ERROR_BIN_FULL:
+		return "error bin full"
+	case CRT571_EVENT_DEVICE_OFFLINE:
+		return "device offline"
+	case CRT571_EVENT_DEVICE_ONLINE:
+		return "device online"
+	}
+	return "unknown"
+}
+
+type CRT571Event struct {
+	Type     CRT571EventType
+	Status   CRT571DeviceStatus // Current status (zero for CRT571_EVENT_DEVICE_OFFLINE)
+	Previous CRT571DeviceStatus // Status before change
+	Err      error              // Cause of CRT571_EVENT_DEVICE_OFFLINE
+	Time     time.Time
+}
+
+// Watch device status: poll STATUS_REQUEST every interval through command
+// queue (with CRT571_PRIORITY_LOW) and send events when ST0/ST1/ST2 change.
+// Conditions present on first poll (e.g. empty stacker) are reported too.
+// Channel is closed when ctx is done.
+func (service *CRT571Service) Watch(ctx context.Context, interval time.Duration) <-chan CRT571Event {
+	events := make(chan CRT571Event, 16)
+	go service.watch(ctx, interval, events)
+	return events
+}
+
+func (service *CRT571Service) watch(ctx context.Context, interval time.Duration, events chan<- CRT571Event) {
+	defer close(events)
+
+	if interval <= 0 {
+		interval = CRT571_DEFAULT_POLL_INTERVAL
+	}
+	ctx = WithPriority(ctx, CRT571_PRIORITY_LOW)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous CRT571DeviceStatus
+	offline := false
+
+	send := func(event CRT571Event) bool {
+		event.Time = time.Now()
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		status, err := service.StatusContext(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		var deviceErr *CRT571DeviceError
+		switch {
+		case err != nil && !errors.As(err, &deviceErr):
+			if !offline {
+				offline = true
+				service.log.Warn("Watch(): device offline", "error", err)
+				if !send(CRT571Event{Type: CRT571_EVENT_DEVICE_OFFLINE, Previous: previous, Err: err}) {
+					return
+				}
+			}
+		case err != nil:
+			service.log.Warn("Watch(): status request failed", "error", err)
+		default:
+			if offline {
+				offline = false
+				if !send(CRT571Event{Type: CRT571_EVENT_DEVICE_ONLINE, Status: status, Previous: previous}) {
+					return
+				}
+			}
+			captured := service.tracker != nil && service.tracker.cardCaptured()
+			for _, t := range statusEvents(previous, status, captured) {
+				if !send(CRT571Event{Type: t, Status: status, Previous: previous}) {
+					return
+				}
+			}
+			previous = status
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Events of status change. Card captured from gate to error card bin
+// (captured) was not removed by customer.
+func statusEvents(previous, status CRT571DeviceStatus, captured bool) []CRT571EventType {
+	var events []CRT571EventType
+
+	if status.Card == CRT571_CARD_IN_GATE && previous.Card != CRT571_CARD_IN_GATE {
+		events = append(events, CRT571_EVENT_CARD_PRESENTED_AT_GATE)
+	}
+	if status.Card == CRT571_CARD_NONE && previous.Card == CRT571_CARD_IN_GATE && !captured {
+		events = append(events, CRT571_EVENT_CARD_REMOVED)
+	}
+	if status.Stacker == CRT571_STACKER_FEW && previous.Stacker != CRT571_STACKER_FEW {
+		events = append(events, CRT571_EVENT_STACKER_LOW)
+	}
+	if status.Stacker == CRT571_STACKER_EMPTY && previous.Stacker != CRT571_STACKER_EMPTY {
+		events = append(events, CRT571_EVENT_STACKER_EMPTY)
+	}
+	if status.ErrorBin == CRT571_ERROR_BIN_FULL && previous.ErrorBin != CRT571_ERROR_BIN_FULL {
+		events = append(events, CRT571_EVENT_ERROR_BIN_FULL)
+	}
+	return events
+}
@@ -0,0 +1,105 @@
+package crt571_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/syntech-pro/crt571"
+	"github.com/syntech-pro/crt571/simulator"
+)
+
+// Next watcher event must be of type want
+func expectEvent(t *testing.T, events <-chan crt571.CRT571Event, want crt571.CRT571EventType) crt571.CRT571Event {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatalf("events closed, want %s", want)
+		}
+		if event.Type != want {
+			t.Fatalf("event %s, want %s", event.Type, want)
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no event, want %s", want)
+	}
+	return crt571.CRT571Event{}
+}
+
+// No watcher event during several polls
+func expectNoEvent(t *testing.T, events <-chan crt571.CRT571Event) {
+	t.Helper()
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %s", event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatch(t *testing.T) {
+	timeouts := map[byte]time.Duration{crt571.CRT571_CM_STATUS_REQUEST: 50 * time.Millisecond}
+	service, dev := newSimulatorService(t, crt571.CRT571Config{CommandTimeouts: timeouts}, simulator.Config{StackerCards: 50, ErrorBinCapacity: 30, Initialized: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := service.Watch(ctx, 10*time.Millisecond)
+	expectNoEvent(t, events)
+
+	dev.SetStackerCards(5)
+	event := expectEvent(t, events, crt571.CRT571_EVENT_STACKER_LOW)
+	if event.Previous.Stacker != crt571.CRT571_STACKER_ENOUGH || event.Status.Stacker != crt571.CRT571_STACKER_FEW {
+		t.Errorf("event status %s, previous %s", event.Status, event.Previous)
+	}
+	expectNoEvent(t, events)
+
+	dev.SetStackerCards(0)
+	expectEvent(t, events, crt571.CRT571_EVENT_STACKER_EMPTY)
+	dev.SetErrorBinCount(30)
+	expectEvent(t, events, crt571.CRT571_EVENT_ERROR_BIN_FULL)
+	expectNoEvent(t, events)
+
+	dev.PowerOff()
+	if event = expectEvent(t, events, crt571.CRT571_EVENT_DEVICE_OFFLINE); event.Err == nil {
+		t.Errorf("offline event without error")
+	}
+	expectNoEvent(t, events)
+	dev.PowerOn()
+	expectEvent(t, events, crt571.CRT571_EVENT_DEVICE_ONLINE)
+	expectNoEvent(t, events)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatalf("event after cancel, want closed channel")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("events are not closed after cancel")
+	}
+}
+
+func TestWatchCardAtGate(t *testing.T) {
+	service, dev := newSimulatorService(t, crt571.CRT571Config{}, simulator.Config{StackerCards: 50, Initialized: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := service.Watch(ctx, 10*time.Millisecond)
+
+	// Customer takes card
+	if _, err := service.MoveTo(crt571.CRT571_POSITION_GATE); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, crt571.CRT571_EVENT_CARD_PRESENTED_AT_GATE)
+	dev.TakeCard()
+	expectEvent(t, events, crt571.CRT571_EVENT_CARD_REMOVED)
+
+	// Card captured from gate is not removed by customer
+	if _, err := service.MoveTo(crt571.CRT571_POSITION_GATE); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, crt571.CRT571_EVENT_CARD_PRESENTED_AT_GATE)
+	if _, err := service.Capture(ctx, "not taken"); err != nil {
+		t.Fatal(err)
+	}
+	expectNoEvent(t, events)
+}